@@ -0,0 +1,94 @@
+// Package accession parses NCBI accession numbers and the query inputs they
+// come in: accession lists, reduced range files, FASTA headers,
+// accession2taxid files, and BLAST tabular output.
+package accession
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// Split splits an accession into the prefix and the numerical value. The
+// version is dropped. E.g. NP_000123.1 -> NP_, 123. Could probably replace
+// with some RegEx...
+func Split(line string) (string, int, error) {
+	var number int
+	var err error
+	for i, char := range line {
+		if _, err := strconv.Atoi(string(char)); err != nil {
+			continue // Skip if not a number
+		}
+		if i == 0 { // Beginning of the line
+			number, err = strconv.Atoi(string(line))
+			if err != nil {
+				return "", 0, err
+			}
+			return "", number, err
+		}
+		prefix := line[:i]
+		numStr := line[i:]
+		if strings.Contains(numStr, ".") {
+			parts := strings.Split(numStr, ".")
+			numStr = parts[0]
+		}
+		if number, err = strconv.Atoi(numStr); err != nil {
+			return "", 0, err
+		}
+		return prefix, number, err
+	}
+	return "", 0, err
+}
+
+// Key is the versionless key used for an accession number. E.g.
+// NP_000123.1 -> NP_123. Zero padding is lost in the reduced files, so it's
+// dropped here too.
+func Key(prefix string, num int) string {
+	return prefix + strconv.Itoa(num)
+}
+
+// FromFastaHeader gets the accessions from a FASTA header line. nr headers
+// have several accession and description pairs separated by Ctrl-A.
+func FromFastaHeader(header string) []string {
+	res := []string{}
+	for _, entry := range strings.Split(strings.TrimPrefix(header, ">"), "\x01") {
+		fields := strings.Fields(entry)
+		if len(fields) > 0 {
+			res = append(res, fields[0])
+		}
+	}
+	return res
+}
+
+// ExpandRange calls fn with each accession in a range, keeping the zero
+// padding. E.g. AB000001-AB000003 -> AB000001, AB000002, AB000003.
+func ExpandRange(input string, fn func(string)) error {
+	p := strings.Split(input, "-")
+	if len(p) != 2 {
+		return util.Handle("Error in accession range "+input,
+			&util.ParseError{Text: input, Err: errors.New("expected one dash")})
+	}
+	prefix, start, err := Split(p[0])
+	if err != nil {
+		return util.Handle("Error in range start "+input,
+			&util.ParseError{Text: input, Err: err})
+	}
+	endPrefix, end, err := Split(p[1])
+	if err != nil {
+		return util.Handle("Error in range end "+input,
+			&util.ParseError{Text: input, Err: err})
+	}
+	if prefix != endPrefix || end < start {
+		return util.Handle("Error in accession range "+input,
+			&util.ParseError{Text: input,
+				Err: errors.New("mismatched range ends")})
+	}
+	width := len(p[0]) - len(prefix)
+	for i := start; i <= end; i++ {
+		fn(fmt.Sprintf("%s%0*d", prefix, width, i))
+	}
+	return err
+}
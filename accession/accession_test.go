@@ -0,0 +1,83 @@
+package accession
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		line   string
+		prefix string
+		num    int
+		ok     bool
+	}{
+		{"NP_000123.1", "NP_", 123, true},
+		{"NP_000123", "NP_", 123, true},
+		{"AB000001", "AB", 1, true},
+		{"WP_012345678.1", "WP_", 12345678, true},
+		{"12345", "", 12345, true},
+		{"XP_", "", 0, true}, // No number
+		{"", "", 0, true},
+		{"AB12x", "", 0, false},
+	}
+	for _, tt := range tests {
+		prefix, num, err := Split(tt.line)
+		if (err == nil) != tt.ok || prefix != tt.prefix || num != tt.num {
+			t.Errorf("Split(%q) = %q, %d, %v. Want %q, %d, ok %v", tt.line,
+				prefix, num, err, tt.prefix, tt.num, tt.ok)
+		}
+	}
+}
+
+func TestFromFastaHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{">NM_000123.1 Some gene", []string{"NM_000123.1"}},
+		{">WP_1.1 desc\x01XP_2.1 other desc\x01YP_3.2 more",
+			[]string{"WP_1.1", "XP_2.1", "YP_3.2"}},
+		{">", []string{}},
+	}
+	for _, tt := range tests {
+		if got := FromFastaHeader(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FromFastaHeader(%q) = %v. Want %v", tt.header, got,
+				tt.want)
+		}
+	}
+}
+
+func TestExpandRange(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+		ok    bool
+	}{
+		{"AB000001-AB000003", []string{"AB000001", "AB000002", "AB000003"},
+			true},
+		{"AB000009-AB000010", []string{"AB000009", "AB000010"}, true},
+		{"AB1-AB1", []string{"AB1"}, true},
+		{"AB3-AB1", nil, false},
+		{"AB1-CD3", nil, false},
+		{"AB1", nil, false},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := ExpandRange(tt.input, func(acc string) {
+			got = append(got, acc)
+		})
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExpandRange(%q) = %v, %v. Want %v, ok %v", tt.input,
+				got, err, tt.want, tt.ok)
+		}
+		var parseErr *util.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			t.Errorf("ExpandRange(%q) error %v isn't a ParseError", tt.input,
+				err)
+		}
+	}
+}
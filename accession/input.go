@@ -0,0 +1,269 @@
+package accession
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// Query input formats accepted by ReadQueries.
+const (
+	FormatReduced    = "reduced"         // PREFIX: N or PREFIX: A-B lines
+	FormatAccessions = "accessions"      // One accession or accession.version per line
+	FormatFasta      = "fasta"           // FASTA headers, optionally gzipped
+	FormatA2T        = "accession2taxid" // NCBI accession2taxid files
+	FormatBlast6     = "blast6"          // BLAST tabular (outfmt 6) subject column
+)
+
+// Stats counts what happened to the lines of a query input.
+type Stats struct {
+	Format      string // Detected format
+	Lines       int    // Total lines read
+	Accessions  int    // Accessions or ranges parsed
+	Skipped     int    // Blank, comment, header, and sequence lines
+	Unparseable int    // Lines that should have had an accession but didn't
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("Input format: %s. %d lines, %d accessions/ranges, %d "+
+		"skipped, %d unparseable.", s.Format, s.Lines, s.Accessions, s.Skipped,
+		s.Unparseable)
+}
+
+// LogValue logs the counts as fields.
+func (s Stats) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("format", s.Format),
+		slog.Int("lines", s.Lines), slog.Int("accessions", s.Accessions),
+		slog.Int("skipped", s.Skipped), slog.Int("unparseable", s.Unparseable))
+}
+
+// OpenInput opens a query (or source) file, decompressing it if it's gzipped.
+func OpenInput(path string) (io.Reader, func() error, error) {
+	return OpenInputFunc(path, nil)
+}
+
+// OpenInputFunc is OpenInput calling fn (if not nil) with the number of
+// bytes read from the file each time, before decompressing. E.g. for
+// progress against the file size.
+func OpenInputFunc(path string, fn func(n int)) (io.Reader, func() error,
+	error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		err = &util.NotFoundError{What: "input file", Name: path, Err: err}
+	}
+	if err != nil {
+		return nil, nil, util.Handle("Error in opening input file", err)
+	}
+	var src io.Reader = file
+	if fn != nil {
+		src = &funcReader{file, fn}
+	}
+	reader := bufio.NewReader(src)
+	magic, _ := reader.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, nil, util.Handle("Error in opening gzipped input", err)
+		}
+		closer := func() error {
+			gz.Close()
+			return file.Close()
+		}
+		return gz, closer, err
+	}
+	return reader, file.Close, err
+}
+
+// funcReader calls fn with the number of bytes of each read.
+type funcReader struct {
+	r  io.Reader
+	fn func(n int)
+}
+
+func (f *funcReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	f.fn(n)
+	return n, err
+}
+
+// DetectFormat looks at the first lines of a query file to guess its
+// format.
+func DetectFormat(path string) (string, error) {
+	reader, closer, err := OpenInput(path)
+	if err != nil {
+		return "", util.Handle("Error in opening input for format detection", err)
+	}
+	defer closer()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for checked := 0; scanner.Scan() && checked < 50; {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		checked++
+		switch {
+		case strings.HasPrefix(line, ">"):
+			return FormatFasta, err
+		case strings.HasPrefix(line, "accession\taccession.version\ttaxid"):
+			return FormatA2T, err
+		case len(strings.Split(line, "\t")) >= 12:
+			return FormatBlast6, err
+		case strings.Contains(line, ": "):
+			return FormatReduced, err
+		}
+		prefix, _, err := Split(strings.Fields(line)[0])
+		if err == nil && prefix != "" {
+			return FormatAccessions, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", util.Handle("Error in reading input for format detection", err)
+	}
+	return "", util.Handle("Error in detecting input format of "+path,
+		&util.ParseError{File: path, Err: errors.New("no recognizable lines")})
+}
+
+// ReadQueries reads every accession in a non-reduced query file and
+// groups the numbers by prefix. Input can be in any order. Versions are
+// dropped, but kept in versions by accession key if it isn't nil. For FASTA
+// headers with several accessions (nr), only the first (representative)
+// accession is queried and the rest are added to members if it isn't nil.
+// Stops if ctx is cancelled.
+func ReadQueries(ctx context.Context, path string, format string,
+	stats *Stats, members map[string][]string, versions map[string]string) (
+	map[string][]int, error) {
+	res := make(map[string][]int)
+	reader, closer, err := OpenInput(path)
+	if err != nil {
+		return res, util.Handle("Error in opening query input", err)
+	}
+	defer closer()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+
+	// Go line by line
+	for scanner.Scan() {
+		if err = ctx.Err(); err != nil {
+			return res, err
+		}
+		line := strings.TrimSpace(scanner.Text())
+		stats.Lines++
+		if line == "" || strings.HasPrefix(line, "#") {
+			stats.Skipped++
+			continue
+		}
+		candidates := []string{}
+		switch format {
+		case FormatFasta:
+			if !strings.HasPrefix(line, ">") {
+				stats.Skipped++ // Sequence line
+				continue
+			}
+			candidates = FromFastaHeader(line)
+			if len(candidates) > 1 && members != nil {
+				AddMembers(members, candidates[0], candidates[1:])
+			}
+		case FormatA2T:
+			if strings.HasPrefix(line, "accession\t") {
+				stats.Skipped++ // Header
+				continue
+			}
+			// Use accession.version if it's there
+			fields := strings.Fields(line)
+			candidates = fields[:1]
+			if len(fields) > 1 {
+				candidates = fields[1:2]
+			}
+		case FormatBlast6:
+			cols := strings.Split(line, "\t")
+			if len(cols) < 2 {
+				stats.Unparseable++
+				continue
+			}
+			candidates = strings.Split(cols[1], "|")
+		default:
+			candidates = strings.Fields(line)[:1]
+		}
+		found := false
+		for _, c := range candidates {
+			prefix, num, err := Split(c)
+			if err != nil || prefix == "" {
+				continue // E.g. gi or ref tags in BLAST subject ids
+			}
+			res[prefix] = append(res[prefix], num)
+			stats.Accessions++
+			if p := strings.Split(c, "."); len(p) > 1 && versions != nil {
+				versions[Key(prefix, num)] = p[1]
+			}
+			found = true
+			if format == FormatBlast6 || format == FormatFasta {
+				break // Only the first real accession in the id or header
+			}
+		}
+		if !found {
+			stats.Unparseable++
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return res, util.Handle("Error in reading query input", err)
+	}
+	return res, err
+}
+
+// AddMembers adds member accessions to the list for a representative
+// accession.
+func AddMembers(members map[string][]string, rep string, others []string) {
+	prefix, num, err := Split(rep)
+	if err != nil || prefix == "" {
+		return
+	}
+	key := Key(prefix, num)
+	members[key] = append(members[key], others...)
+}
+
+// LoadMemberLinks reads a links file from extract.Fasta of member
+// and representative accession pairs. Stops if ctx is cancelled.
+func LoadMemberLinks(ctx context.Context, path string,
+	members map[string][]string) error {
+	reader, closer, err := OpenInput(path)
+	if err != nil {
+		return util.Handle("Error in opening links file", err)
+	}
+	defer closer()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) != 2 {
+			continue
+		}
+		AddMembers(members, parts[1], parts[:1])
+	}
+	if err = scanner.Err(); err != nil {
+		return util.Handle("Error in reading links file", err)
+	}
+	return err
+}
+
+// SortedPrefixes gives the keys of a prefix to numbers map in order.
+func SortedPrefixes(input map[string][]int) []string {
+	res := []string{}
+	for k := range input {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
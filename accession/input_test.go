@@ -0,0 +1,39 @@
+package accession
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenInputFunc(t *testing.T) {
+	text := "NP_: 1-5\nXP_: 7\n"
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(text))
+	w.Close()
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"plain.txt": []byte(text),
+		"gzipped.txt.gz": gz.Bytes()} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		read := 0
+		reader, closer, err := OpenInputFunc(path, func(n int) { read += n })
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(reader)
+		closer()
+		if err != nil || string(got) != text {
+			t.Errorf("%s read %q, %v. Want %q", name, got, err, text)
+		}
+		if read != len(data) {
+			t.Errorf("%s counted %d bytes read. Want the file size %d", name,
+				read, len(data))
+		}
+	}
+}
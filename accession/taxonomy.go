@@ -0,0 +1,77 @@
+package accession
+
+import (
+	"bufio"
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// A TaxIndex maps versionless accession keys (see Key) to NCBI
+// taxonomy IDs. Built from accession2taxid files.
+type TaxIndex map[string]int32
+
+// LoadAccession2Taxid builds a TaxIndex from NCBI accession2taxid files (e.g.
+// prot.accession2taxid.gz, nucl_gb.accession2taxid.gz). Columns are
+// accession, accession.version, taxid, gi. If prefixes isn't nil, only
+// accessions with those prefixes are kept to save memory. Stops if ctx is
+// cancelled.
+func LoadAccession2Taxid(ctx context.Context, paths []string,
+	prefixes map[string]bool) (TaxIndex, error) {
+	res := make(TaxIndex)
+	for _, path := range paths {
+		if err := loadTaxidFile(ctx, res, path, prefixes); err != nil {
+			return res, util.Handle("Error in loading "+path, err)
+		}
+	}
+	return res, nil
+}
+
+// Adds the accessions from one accession2taxid file to the index.
+func loadTaxidFile(ctx context.Context, index TaxIndex, path string,
+	prefixes map[string]bool) error {
+	reader, closer, err := OpenInput(path)
+	if err != nil {
+		return util.Handle("Error in opening accession2taxid file", err)
+	}
+	defer closer()
+	scanner := bufio.NewScanner(reader)
+	bad := 0
+	for scanner.Scan() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 3 || cols[0] == "accession" {
+			continue // Header
+		}
+		prefix, num, err := Split(cols[0])
+		if err != nil || prefix == "" {
+			bad++
+			continue
+		}
+		if prefixes != nil && !prefixes[prefix] {
+			continue
+		}
+		taxid, err := strconv.Atoi(cols[2])
+		if err != nil {
+			bad++
+			continue
+		}
+		index[Key(prefix, num)] = int32(taxid)
+	}
+	if err = scanner.Err(); err != nil {
+		return util.Handle("Error in reading accession2taxid file", err)
+	}
+	if bad > 0 {
+		util.Log(ctx).Warn("Skipped lines", "path", path, "unparseable", bad)
+	}
+	return err
+}
+
+// Lookup gets the taxid for an accession. 0 if unknown.
+func (t TaxIndex) Lookup(prefix string, num int) int {
+	return int(t[Key(prefix, num)])
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// A coverStep is one file picked by the download planner.
+type coverStep struct {
+	file       string  // Source file name
+	size       int64   // Bytes
+	newCovered int     // Accessions first covered by this file
+	coverage   float64 // Cumulative percent of found accessions covered
+	totalSize  int64   // Cumulative bytes of files picked so far
+}
+
+// Example of a caller function for planning which smaller files to download
+// instead of the whole nr, from the results of matchSequencesCaller.
+func coverPlanCaller() error {
+	home := util.UserHome()
+	results := home + "/sequence_lists/blast/db/FASTA/nr_run_1.txt"
+	sizesFile := home + "/sequence_lists/source_sizes.txt"
+	sizes, err := loadFileSizes(sizesFile)
+	if err != nil {
+		return util.Handle("Error in loading file sizes", err)
+	}
+	plan, unsized, total, err := planDownloads(results, sizes)
+	if err != nil {
+		return util.Handle("Error in planning downloads", err)
+	}
+
+	// Report
+	fmt.Printf("%-50s | %12s | %10s | %8s | %s\n", "File", "Size",
+		"New", "Coverage", "Total size")
+	for _, step := range plan {
+		fmt.Printf("%-50s | %12d | %10d | %7.2f%% | %d\n", step.file, step.size,
+			step.newCovered, step.coverage, step.totalSize)
+	}
+	covered := 0
+	for _, step := range plan {
+		covered += step.newCovered
+	}
+	fmt.Printf("%d files cover %d of %d found accessions.\n", len(plan),
+		covered, total)
+	if len(unsized) > 0 {
+		fmt.Printf("%d files with unknown sizes were left out. Add them to %s "+
+			"to plan them:\n", len(unsized), sizesFile)
+		for _, name := range unsized {
+			fmt.Println(name)
+		}
+	}
+	if len(plan) > 0 {
+		planned := plan[len(plan)-1].totalSize
+		if whole, present := sizes["nr.gz"]; present {
+			fmt.Printf("Planned download: %d bytes. Whole nr: %d bytes. Saved: "+
+				"%d bytes (%.1f%%).\n", planned, whole, whole-planned,
+				float64(whole-planned)/float64(whole)*100)
+		} else {
+			fmt.Printf("Planned download: %d bytes. Add nr.gz to %s to compare.\n",
+				planned, sizesFile)
+		}
+	}
+	return err
+}
+
+// planDownloads computes a small set of source files covering all the found
+// accessions in a matchSequences results file. Greedy weighted set cover:
+// repeatedly picks the file with the lowest size per newly covered accession.
+// Files with unknown sizes can't be weighed, so they're left out and returned
+// separately. Accessions only in those files stay uncovered. Returns the
+// picked files in order, the left out files, and the number of found
+// accessions.
+func planDownloads(results string, sizes map[string]int64) ([]coverStep,
+	[]string, int, error) {
+	// Read which targets each file covers. Targets are ids into weights,
+	// which is the number of accessions in each target (ranges count more).
+	fileTargets := make(map[string][]int)
+	listed := make(map[string]map[int]bool)
+	targetIds := make(map[string]int)
+	weights := []int{}
+	file, err := os.Open(results)
+	if err != nil {
+		return nil, nil, 0, util.Handle("Error in opening results file", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), " | ")
+		if len(cols) < 4 || strings.HasPrefix(cols[0], "Target") {
+			continue // Header or not found line
+		}
+		target := strings.TrimSpace(cols[0])
+		id, present := targetIds[target]
+		if !present {
+			id = len(weights)
+			targetIds[target] = id
+			weights = append(weights, targetWeight(target))
+		}
+		name := sourceFileName(strings.TrimSpace(cols[3]))
+		if !listed[name][id] { // Counted once per file
+			if listed[name] == nil {
+				listed[name] = make(map[int]bool)
+			}
+			listed[name][id] = true
+			fileTargets[name] = append(fileTargets[name], id)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, 0, util.Handle("Error in reading results file", err)
+	}
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+
+	// Greedy picks. Lazy: a file's gain only goes down as others are picked,
+	// so its cost in the heap is a lower bound. The top file is only
+	// re-weighed when it comes up, and picked if it's still the cheapest.
+	unsized := []string{}
+	candidates := &coverHeap{}
+	for name, targets := range fileTargets {
+		if sizes[name] <= 0 {
+			unsized = append(unsized, name)
+			continue
+		}
+		gain := 0
+		for _, id := range targets {
+			gain += weights[id]
+		}
+		*candidates = append(*candidates, coverCandidate{name, gain,
+			float64(sizes[name]) / float64(gain)})
+	}
+	sort.Strings(unsized)
+	heap.Init(candidates)
+	res := []coverStep{}
+	covered := make([]bool, len(weights))
+	coveredTotal := 0
+	var totalSize int64
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(coverCandidate)
+		gain := 0
+		for _, id := range fileTargets[c.name] {
+			if !covered[id] {
+				gain += weights[id]
+			}
+		}
+		if gain == 0 {
+			continue
+		}
+		if gain < c.gain {
+			// Weighed before other picks. Put back if it's not the cheapest.
+			c.gain = gain
+			c.cost = float64(sizes[c.name]) / float64(gain)
+			if candidates.Len() > 0 && candidates.less(candidates.top(), c) {
+				heap.Push(candidates, c)
+				continue
+			}
+		}
+		for _, id := range fileTargets[c.name] {
+			covered[id] = true
+		}
+		coveredTotal += gain
+		totalSize += sizes[c.name]
+		res = append(res, coverStep{c.name, sizes[c.name], gain,
+			float64(coveredTotal) / float64(total) * 100, totalSize})
+	}
+	return res, unsized, total, err
+}
+
+// A coverCandidate is a file the download planner can pick, with its gain
+// and cost when it was last weighed.
+type coverCandidate struct {
+	name string
+	gain int     // Accessions not covered yet
+	cost float64 // Bytes per accession not covered yet
+}
+
+// coverHeap orders candidates cheapest first, then by name. Implements
+// heap.Interface.
+type coverHeap []coverCandidate
+
+func (h coverHeap) Len() int {
+	return len(h)
+}
+
+func (h coverHeap) Less(i, j int) bool {
+	return h.less(h[i], h[j])
+}
+
+func (h coverHeap) less(a, b coverCandidate) bool {
+	if a.cost != b.cost {
+		return a.cost < b.cost
+	}
+	return a.name < b.name
+}
+
+func (h coverHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *coverHeap) Push(x interface{}) {
+	*h = append(*h, x.(coverCandidate))
+}
+
+func (h *coverHeap) Pop() interface{} {
+	old := *h
+	res := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return res
+}
+
+// top gives the cheapest candidate without removing it.
+func (h coverHeap) top() coverCandidate {
+	return h[0]
+}
+
+// targetWeight is the number of accessions in a results target. E.g. NP_5 is
+// 1 and NP_5-9 is 5.
+func targetWeight(target string) int {
+	p := strings.Split(target, "-")
+	if len(p) != 2 {
+		return 1
+	}
+	_, start, err := accession.Split(p[0])
+	if err != nil {
+		return 1
+	}
+	end, err := strconv.Atoi(p[1])
+	if err != nil || end < start {
+		return 1
+	}
+	return end - start + 1
+}
+
+// sourceFileName gets the original source file name from a searched file
+// name. E.g. /complete/complete.1.protein.faa.gz.trimmed ->
+// complete.1.protein.faa.gz.
+func sourceFileName(name string) string {
+	name = strings.TrimSuffix(name, ".txt")
+	name = strings.TrimSuffix(name, ".trimmed")
+	return filepath.Base(name)
+}
+
+// loadFileSizes reads a file of source file names and sizes in bytes, one per
+// line separated by a tab. Names are reduced to base names.
+func loadFileSizes(path string) (map[string]int64, error) {
+	res := make(map[string]int64)
+	file, err := os.Open(path)
+	if err != nil {
+		return res, util.Handle("Error in opening sizes file", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) != 2 {
+			continue
+		}
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		res[filepath.Base(parts[0])] = size
+	}
+	if err = scanner.Err(); err != nil {
+		return res, util.Handle("Error in reading sizes file", err)
+	}
+	return res, err
+}
+
+// Example of making a sizes file for loadFileSizes from an rsync listing of
+// the remote folders.
+func remoteFileSizes(ctx context.Context) error {
+	folders := []string{"rsync://ftp.ncbi.nih.gov/refseq/release/complete/",
+		"rsync://ftp.ncbi.nih.gov/genbank/",
+		"rsync://ftp.ncbi.nih.gov/blast/db/FASTA/"}
+	path := util.UserHome() + "/sequence_lists/source_sizes.txt"
+	if util.DryRun(ctx) {
+		for _, folder := range folders {
+			util.Planned(ctx, util.PlanList, folder, -1)
+		}
+		util.PlannedOutput(ctx, path, -1)
+		return nil
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return util.Handle("Error in creating sizes file", err)
+	}
+	defer out.Close()
+	for _, folder := range folders {
+		// Lines look like: -rw-r--r--  1,234,567 2017/01/01 10:00:00 name
+		list := util.Cmd{Args: []string{"rsync", "--list-only", "--no-motd",
+			folder}, Timeout: 10 * time.Minute}
+		err = util.Lines(ctx, func(line string) error {
+			fields := strings.Fields(line)
+			if len(fields) < 5 || !strings.HasPrefix(fields[0], "-") {
+				return nil
+			}
+			size := strings.Replace(fields[1], ",", "", -1)
+			_, err := out.WriteString(fields[4] + "\t" + size + "\n")
+			return err
+		}, list)
+		if err != nil {
+			return util.Handle("Error in listing "+folder, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Writes a results file with a line for each target and file.
+func writeResults(t *testing.T, lines [][2]string) string {
+	path := filepath.Join(t.TempDir(), "results.txt")
+	out := "Target          | Found in range | Collection | In file\n"
+	for _, l := range lines {
+		out += fmt.Sprintf("%-15s | 1 | refseq | /%s.txt\n", l[0], l[1])
+	}
+	if err := ioutil.WriteFile(path, []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPlanDownloads(t *testing.T) {
+	results := writeResults(t, [][2]string{
+		{"NP_1-10", "big"}, {"NP_11", "big"}, {"NP_12", "big"},
+		{"NP_1-10", "small"},
+		{"NP_11", "tiny"},
+		{"NP_12", "unsized"}, {"NP_13", "unsized"},
+	})
+	sizes := map[string]int64{"big": 1000, "small": 50, "tiny": 10}
+	plan, unsized, total, err := planDownloads(results, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// small: 5 bytes per accession. tiny: 10. big then only covers NP_12.
+	got := []string{}
+	for _, step := range plan {
+		got = append(got, fmt.Sprintf("%s %d %d", step.file, step.newCovered,
+			step.totalSize))
+	}
+	want := []string{"small 10 50", "tiny 1 60", "big 1 1060"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Planned %v. Want %v", got, want)
+	}
+	if !reflect.DeepEqual(unsized, []string{"unsized"}) || total != 13 {
+		t.Errorf("Got unsized %v, total %d. Want [unsized], 13", unsized, total)
+	}
+}
+
+// The lazy picks match picking by re-weighing every file each time.
+func TestPlanDownloadsLazy(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	lines := [][2]string{}
+	sizes := make(map[string]int64)
+	fileTargets := make(map[string][]string)
+	for f := 0; f < 30; f++ {
+		name := fmt.Sprintf("f%02d", f)
+		sizes[name] = int64(rnd.Intn(1000) + 1)
+		for i := rnd.Intn(20); i >= 0; i-- {
+			target := fmt.Sprintf("NP_%d", rnd.Intn(100))
+			lines = append(lines, [2]string{target, name})
+			fileTargets[name] = append(fileTargets[name], target)
+		}
+	}
+	plan, _, _, err := planDownloads(writeResults(t, lines), sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, step := range plan {
+		got = append(got, step.file)
+	}
+
+	want := []string{}
+	covered := make(map[string]bool)
+	for {
+		best, bestCost := "", 0.0
+		for name, targets := range fileTargets {
+			gain := map[string]bool{}
+			for _, target := range targets {
+				if !covered[target] {
+					gain[target] = true
+				}
+			}
+			if len(gain) == 0 {
+				continue
+			}
+			cost := float64(sizes[name]) / float64(len(gain))
+			if best == "" || cost < bestCost ||
+				(cost == bestCost && name < best) {
+				best, bestCost = name, cost
+			}
+		}
+		if best == "" {
+			break
+		}
+		for _, target := range fileTargets[best] {
+			covered[target] = true
+		}
+		want = append(want, best)
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Lazy picks %v. Want %v", got, want)
+	}
+}
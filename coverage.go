@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// prefixCoverage tracks how well the collections cover the queries for one
+// prefix.
+type prefixCoverage struct {
+	queried     int
+	found       int
+	files       map[string]bool // Distinct files hit
+	collections map[string]int  // Found counts by collection
+}
+
+// A coverageRow is one prefix (or the total) in the coverage report.
+type coverageRow struct {
+	Prefix      string         `json:"prefix"`
+	Queried     int            `json:"queried"`
+	Found       int            `json:"found"`
+	Percent     float64        `json:"percent"`
+	Files       int            `json:"files"`
+	Collections map[string]int `json:"collections"`
+}
+
+// A coverageReport has the coverage of the queries per prefix and per
+// collection.
+type coverageReport struct {
+	Prefixes    []coverageRow  `json:"prefixes"`
+	Collections map[string]int `json:"collections"` // Found counts
+	Total       coverageRow    `json:"total"`
+}
+
+// recordCoverage adds count queried sequences for a prefix and where they
+// were found, if anywhere. A sequence found in several collections counts
+// once for each of them.
+func recordCoverage(run *matchRun, prefix string, count int,
+	res []search.Match) {
+	if run.coverage == nil {
+		return
+	}
+	c, present := run.coverage[prefix]
+	if !present {
+		c = &prefixCoverage{files: make(map[string]bool),
+			collections: make(map[string]int)}
+		run.coverage[prefix] = c
+	}
+	c.queried += count
+	if len(res) == 0 {
+		return
+	}
+	c.found += count
+	seen := make(map[string]bool)
+	for _, m := range res {
+		c.files[m.Collection+"/"+m.File] = true
+		if !seen[m.Collection] {
+			c.collections[m.Collection] += count
+			seen[m.Collection] = true
+		}
+	}
+}
+
+// buildCoverageReport summarizes the recorded coverage. The total counts
+// each file once even if it has several of the prefixes.
+func buildCoverageReport(run *matchRun) coverageReport {
+	res := coverageReport{Collections: make(map[string]int)}
+	files := make(map[string]bool)
+	res.Total = coverageRow{Prefix: "TOTAL", Collections: res.Collections}
+	prefixes := []string{}
+	for k := range run.coverage {
+		prefixes = append(prefixes, k)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		c := run.coverage[prefix]
+		row := coverageRow{prefix, c.queried, c.found,
+			percent(c.found, c.queried), len(c.files), c.collections}
+		res.Prefixes = append(res.Prefixes, row)
+		res.Total.Queried += c.queried
+		res.Total.Found += c.found
+		for k := range c.files {
+			files[k] = true
+		}
+		for k, v := range c.collections {
+			res.Collections[k] += v
+		}
+	}
+	res.Total.Files = len(files)
+	res.Total.Percent = percent(res.Total.Found, res.Total.Queried)
+	return res
+}
+
+// Percent of a out of b. 0 if b is 0.
+func percent(a int, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b) * 100
+}
+
+// writeCoverageReport writes the coverage report as JSON to path + ".json"
+// and as a table to path + ".txt" and stdout.
+func writeCoverageReport(run *matchRun, path string) error {
+	report := buildCoverageReport(run)
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return util.Handle("Error in formatting coverage JSON", err)
+	}
+	if err = ioutil.WriteFile(path+".json", data, 0644); err != nil {
+		return util.Handle("Error in writing coverage JSON", err)
+	}
+	file, err := os.Create(path + ".txt")
+	if err != nil {
+		return util.Handle("Error in creating coverage table", err)
+	}
+	defer file.Close()
+	fmt.Println("COVERAGE:")
+	return writeCoverageTable(report, io.MultiWriter(file, os.Stdout))
+}
+
+// writeCoverageTable writes a readable table of the coverage report with a
+// column of found counts for each collection.
+func writeCoverageTable(report coverageReport, out io.Writer) error {
+	names := reportCollections(report)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "Prefix\tQueried\tFound\tCoverage\tFiles\t")
+	for _, name := range names {
+		fmt.Fprint(w, name+"\t")
+	}
+	fmt.Fprintln(w)
+	rows := append(report.Prefixes, report.Total)
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f%%\t%d\t", row.Prefix, row.Queried,
+			row.Found, row.Percent, row.Files)
+		for _, name := range names {
+			fmt.Fprintf(w, "%d\t", row.Collections[name])
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// reportCollections gives the names of the collections in a report in order.
+func reportCollections(report coverageReport) []string {
+	res := []string{}
+	for k := range report.Collections {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
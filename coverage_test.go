@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+)
+
+func TestBuildCoverageReport(t *testing.T) {
+	run := &matchRun{coverage: make(map[string]*prefixCoverage)}
+	both := []search.Match{{Found: "1-9", Collection: "refseq", File: "/a"},
+		{Found: "5", Collection: "genbank", File: "/b"}}
+	recordCoverage(run, "NM_", 3, both)
+	recordCoverage(run, "NM_", 1, nil)
+	// Same file as NM_ in refseq.
+	recordCoverage(run, "XM_", 2, both[:1])
+
+	report := buildCoverageReport(run)
+	tests := []struct {
+		row                   coverageRow
+		queried, found, files int
+	}{
+		{report.Prefixes[0], 4, 3, 2}, // NM_
+		{report.Prefixes[1], 2, 2, 1}, // XM_
+		{report.Total, 6, 5, 2},
+	}
+	for _, tt := range tests {
+		if tt.row.Queried != tt.queried || tt.row.Found != tt.found ||
+			tt.row.Files != tt.files {
+			t.Errorf("%s got %d queried, %d found in %d files. Want %d, %d, %d",
+				tt.row.Prefix, tt.row.Queried, tt.row.Found, tt.row.Files,
+				tt.queried, tt.found, tt.files)
+		}
+	}
+	if report.Collections["refseq"] != 5 || report.Collections["genbank"] != 3 {
+		t.Errorf("Got collection counts %v", report.Collections)
+	}
+}
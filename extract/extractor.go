@@ -0,0 +1,143 @@
+// Package extract gets the accession numbers (and optionally sequence
+// metadata) out of NCBI source files: GenBank flat files and FASTA files,
+// including nr with several accessions per header.
+//
+// Example:
+//
+//	e := &extract.Extractor{Home: home, Metadata: true}
+//	err := e.ExtractFile(ctx, "/genbank/gbbct1.seq.gz")
+package extract
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/fetch"
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// An Extractor downloads remote source files and writes out the accession
+// lists. Downloads go to Home/source_files and results to
+// Home/sequence_lists, in the same folder structure as the remote.
+type Extractor struct {
+	Home     string
+	Links    bool // Write nr member to representative links (.links.txt)
+	Metadata bool // Write sequence metadata sidecars (.meta.tsv)
+	// Source file sizes by base name, for the download estimates of a dry
+	// run. Optional.
+	Sizes map[string]int64
+}
+
+// Dest gives the accession list path for a remote file.
+func (e *Extractor) Dest(file string) string {
+	return e.Home + "/sequence_lists" + file + ".txt"
+}
+
+// Outputs gives the paths of the files written for a remote file. Only some
+// exist depending on the file type and settings.
+func (e *Extractor) Outputs(file string) []string {
+	dest := e.Dest(file)
+	base := e.Home + "/sequence_lists" + file
+	return []string{dest, dest + ".headers.tsv", base + ".meta.tsv",
+		base + ".links.txt"}
+}
+
+// ExtractFile downloads a file from the remote server and extracts the
+// accession numbers. Files with results already are skipped, so if
+// extraction fails or ctx is cancelled the partial outputs are removed, along
+// with the download. In a dry run the download and outputs are only planned.
+func (e *Extractor) ExtractFile(ctx context.Context, file string) error {
+	var err error
+	dest := e.Dest(file)
+	if _, err = os.Stat(dest); err == nil {
+		util.Log(ctx).Info("Processed already", "file", file)
+		util.Planned(ctx, util.PlanSkip, dest, -1)
+		return err
+	}
+	if util.DryRun(ctx) {
+		e.plan(ctx, file)
+		return nil
+	}
+	util.Log(ctx).Info("Started", "file", file)
+
+	// Download file
+	if err = fetch.Rsync(ctx, e.Home, file); err != nil {
+		return util.Handle("Error in downloading file", err)
+	}
+
+	// Process
+	input := fetch.LocalPath(e.Home, file)
+	dir := filepath.Dir(dest) // Make sub-folders
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return util.Handle("Error in creating sub-folders", err)
+	}
+	meta := ""
+	if e.Metadata {
+		meta = e.Home + "/sequence_lists" + file + ".meta.tsv"
+	}
+	format := "fasta"
+	if strings.Contains(file, "genbank") {
+		format = "genbank"
+	}
+	start := time.Now()
+	if format == "genbank" {
+		// Genbank formatting: All the accessions on the ACCESSION lines, with
+		// versions and divisions in a headers file.
+		err = Genbank(ctx, input, dest, file, meta)
+	} else {
+		// FASTA file formatting: Every accession in the header lines.
+		links := ""
+		if e.Links {
+			links = e.Home + "/sequence_lists" + file + ".links.txt"
+		}
+		err = Fasta(ctx, input, dest, links, meta)
+	}
+	if err != nil {
+		for _, path := range e.Outputs(file) {
+			os.Remove(path)
+		}
+		os.Remove(input) // Downloaded again on a retry
+		return util.Handle("Error in extracting accessions from "+file, err)
+	}
+	took := time.Since(start)
+	metrics.ExtractSeconds.WithLabelValues(format).Observe(took.Seconds())
+	if info, err := os.Stat(input); err == nil {
+		metrics.ExtractBytes.WithLabelValues(format).Add(float64(info.Size()))
+	}
+
+	// Delete temp downloaded file
+	if err = os.Remove(input); err != nil {
+		return util.Handle("Error in removing file.", err)
+	}
+
+	util.Log(ctx).Info("Finished", "file", file, "took", took.String())
+	return err
+}
+
+// Records the download and outputs of extracting a file in a dry run.
+func (e *Extractor) plan(ctx context.Context, file string) {
+	size, present := e.Sizes[filepath.Base(file)]
+	if !present {
+		size = -1
+	}
+	if _, err := os.Stat(fetch.LocalPath(e.Home, file)); err != nil {
+		util.Planned(ctx, util.PlanDownload, fetch.Server+file, size)
+	}
+	dest := e.Dest(file)
+	util.PlannedOutput(ctx, dest, -1)
+	base := e.Home + "/sequence_lists" + file
+	genbank := strings.Contains(file, "genbank")
+	if genbank {
+		util.PlannedOutput(ctx, dest+".headers.tsv", -1)
+	}
+	if e.Metadata {
+		util.PlannedOutput(ctx, base+".meta.tsv", -1)
+	}
+	if e.Links && !genbank {
+		util.PlannedOutput(ctx, base+".links.txt", -1)
+	}
+}
@@ -0,0 +1,112 @@
+package extract
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// Fasta writes every accession in the FASTA headers of input to dest, one
+// per line. nr headers join several accessions with Ctrl-A (each with its own
+// description), so all of them are written. If links isn't empty, each member
+// accession is also written there with the representative (first) accession
+// of its header. E.g.
+// >WP_1.1 desc [Org A]^AXP_2.1 desc [Org B] -> XP_2.1	WP_1.1
+// If meta isn't empty, sequence metadata for each accession is written there
+// too. Stops at the next header if ctx is cancelled.
+func Fasta(ctx context.Context, input string, dest string, links string,
+	meta string) error {
+	reader, closer, err := accession.OpenInput(input)
+	if err != nil {
+		return util.Handle("Error in opening FASTA file", err)
+	}
+	defer closer()
+	outFile, err := os.Create(dest)
+	if err != nil {
+		return util.Handle("Error in creating out file", err)
+	}
+	defer outFile.Close()
+	out := bufio.NewWriter(outFile)
+	var linkOut *bufio.Writer
+	if links != "" {
+		linkFile, err := os.Create(links)
+		if err != nil {
+			return util.Handle("Error in creating links file", err)
+		}
+		defer linkFile.Close()
+		linkOut = bufio.NewWriter(linkFile)
+	}
+	var metaOut *MetaWriter
+	if meta != "" {
+		if metaOut, err = NewMetaWriter(meta); err != nil {
+			return util.Handle("Error in setting up metadata file", err)
+		}
+		defer metaOut.Close()
+	}
+	// Metadata for a header is written once its sequence length is known.
+	header, length := "", 0
+	molType := fastaMolType(input)
+	writeMeta := func() error {
+		if metaOut == nil || header == "" {
+			return nil
+		}
+		for _, r := range fastaMetaRecords(header, length, molType) {
+			if err := metaOut.Write(r); err != nil {
+				return util.Handle("Error in writing metadata", err)
+			}
+		}
+		return nil
+	}
+
+	// Go line by line. nr headers can be very long.
+	emitted := metrics.AccessionsEmitted.WithLabelValues("fasta")
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 256*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, ">") {
+			length += len(strings.TrimSpace(line))
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = writeMeta(); err != nil {
+			return err
+		}
+		header, length = line, 0
+		accessions := accession.FromFastaHeader(line)
+		emitted.Add(float64(len(accessions)))
+		for i, acc := range accessions {
+			out.WriteString(acc + "\n")
+			if linkOut != nil && i > 0 {
+				linkOut.WriteString(acc + "\t" + accessions[0] + "\n")
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return util.Handle("Error in reading FASTA file", err)
+	}
+	if err = writeMeta(); err != nil {
+		return err
+	}
+	if metaOut != nil {
+		if err = metaOut.Close(); err != nil {
+			return err
+		}
+	}
+	if linkOut != nil {
+		if err = linkOut.Flush(); err != nil {
+			return util.Handle("Error in writing links file", err)
+		}
+	}
+	if err = out.Flush(); err != nil {
+		return util.Handle("Error in writing out file", err)
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package extract
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// A GenbankHeader has the accession info from the header of one GenBank
+// flat file record, plus the sequence info for metadata.
+type GenbankHeader struct {
+	Primary    string   // First accession on the ACCESSION line
+	Secondary  []string // Other single accessions on the ACCESSION line
+	Ranges     []string // Ranged accessions. E.g. AB000001-AB000010
+	Version    string   // From the VERSION line. E.g. AB000001.1
+	Division   string   // From the LOCUS line. E.g. BCT
+	File       string   // Source file the record came from
+	Length     int      // From the LOCUS line
+	MolType    string   // From the LOCUS line. E.g. DNA, mRNA, protein
+	Definition string   // DEFINITION, joined across lines
+	Organism   string   // ORGANISM under SOURCE
+	Taxid      string   // First /db_xref="taxon:N" in the features
+	Sequence   string   // ORIGIN section, if asked for
+}
+
+// ParseGenbank reads GenBank flat file records and calls fn with the
+// header of each one. ACCESSION and DEFINITION lines can continue onto
+// following indented lines. The sequence is only collected if withSequence
+// is set. Parse errors from fn without a file get the file and line of the
+// record.
+func ParseGenbank(reader io.Reader, file string, withSequence bool,
+	fn func(GenbankHeader) error) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	cur := GenbankHeader{File: file}
+	keyword := ""
+	var seq strings.Builder
+	lineNum, start := 0, 1 // Current line and start of the record
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "//" { // End of record
+			if cur.Primary != "" {
+				cur.Sequence = seq.String()
+				if err := fn(cur); err != nil {
+					var parseErr *util.ParseError
+					if errors.As(err, &parseErr) && parseErr.File == "" {
+						parseErr.File, parseErr.Line = file, start
+					}
+					return err
+				}
+			}
+			cur = GenbankHeader{File: file}
+			seq.Reset()
+			keyword = ""
+			start = lineNum + 1
+			continue
+		}
+		if len(line) > 0 && line[0] != ' ' {
+			// New keyword. Data starts at column 13.
+			fields := strings.Fields(line)
+			keyword = fields[0]
+			line = strings.Join(fields[1:], " ")
+		} else if keyword == "ORIGIN" {
+			// Sequence lines: position then blocks of 10 bases
+			if fields := strings.Fields(line); withSequence && len(fields) > 1 {
+				for _, block := range fields[1:] {
+					seq.WriteString(block)
+				}
+			}
+			continue
+		} else if keyword != "ACCESSION" && keyword != "DEFINITION" {
+			// Sub-keywords and feature qualifiers used for metadata
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "ORGANISM ") {
+				cur.Organism = strings.TrimSpace(trimmed[len("ORGANISM"):])
+			} else if strings.HasPrefix(trimmed, `/db_xref="taxon:`) &&
+				cur.Taxid == "" {
+				cur.Taxid = strings.Trim(trimmed[len(`/db_xref="taxon:`):], `"`)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		switch keyword {
+		case "LOCUS":
+			// LOCUS name length bp type topology division date. Proteins have
+			// aa instead of bp and no type.
+			if len(fields) >= 2 {
+				cur.Division = fields[len(fields)-2]
+			}
+			if len(fields) >= 4 {
+				cur.Length, _ = strconv.Atoi(fields[1])
+				cur.MolType = fields[3]
+				if fields[2] == "aa" {
+					cur.MolType = "protein"
+				}
+			}
+			keyword = ""
+		case "DEFINITION":
+			if cur.Definition != "" {
+				cur.Definition += " "
+			}
+			cur.Definition += strings.Join(fields, " ")
+		case "ACCESSION":
+			for _, acc := range fields {
+				if strings.Contains(acc, "-") {
+					cur.Ranges = append(cur.Ranges, acc)
+				} else if cur.Primary == "" {
+					cur.Primary = acc
+				} else {
+					cur.Secondary = append(cur.Secondary, acc)
+				}
+			}
+		case "VERSION":
+			if len(fields) > 0 {
+				cur.Version = fields[0]
+			}
+			keyword = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return util.Handle("Error in reading GenBank records",
+			&util.ParseError{File: file, Line: lineNum + 1, Err: err})
+	}
+	return nil
+}
+
+// Genbank writes all the accessions in a GenBank flat file
+// (primary, secondary, and expanded ranges) to dest, one per line. The header
+// details for each record go to a tab-separated dest.headers.tsv with
+// columns: primary, version, secondary, ranges, division, file. If meta isn't
+// empty, sequence metadata for each record is written there too. Stops
+// between records if ctx is cancelled.
+func Genbank(ctx context.Context, input string, dest string, file string,
+	meta string) error {
+	reader, closer, err := accession.OpenInput(input)
+	if err != nil {
+		return util.Handle("Error in opening GenBank file", err)
+	}
+	defer closer()
+	outFile, err := os.Create(dest)
+	if err != nil {
+		return util.Handle("Error in creating out file", err)
+	}
+	defer outFile.Close()
+	headerFile, err := os.Create(dest + ".headers.tsv")
+	if err != nil {
+		return util.Handle("Error in creating headers file", err)
+	}
+	defer headerFile.Close()
+	out := bufio.NewWriter(outFile)
+	headers := bufio.NewWriter(headerFile)
+	emitted := metrics.AccessionsEmitted.WithLabelValues("genbank")
+	writeAcc := func(acc string) {
+		out.WriteString(acc + "\n")
+		emitted.Inc()
+	}
+	var metaOut *MetaWriter
+	if meta != "" {
+		if metaOut, err = NewMetaWriter(meta); err != nil {
+			return util.Handle("Error in setting up metadata file", err)
+		}
+		defer metaOut.Close()
+	}
+
+	err = ParseGenbank(reader, file, false,
+		func(h GenbankHeader) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			writeAcc(h.Primary)
+			for _, acc := range h.Secondary {
+				writeAcc(acc)
+			}
+			for _, r := range h.Ranges {
+				if err := accession.ExpandRange(r, writeAcc); err != nil {
+					return err
+				}
+			}
+			_, err := headers.WriteString(strings.Join([]string{h.Primary,
+				h.Version, strings.Join(h.Secondary, ","),
+				strings.Join(h.Ranges, ","), h.Division, h.File}, "\t") + "\n")
+			if err != nil || metaOut == nil {
+				return err
+			}
+			return metaOut.Write(MetaRecord{h.Primary, h.Version, h.Length,
+				h.MolType, h.Definition, h.Organism, h.Taxid})
+		})
+	if err != nil {
+		return util.Handle("Error in parsing GenBank headers", err)
+	}
+	if err = headers.Flush(); err != nil {
+		return util.Handle("Error in writing headers file", err)
+	}
+	if err = out.Flush(); err != nil {
+		return util.Handle("Error in writing out file", err)
+	}
+	if metaOut != nil {
+		return metaOut.Close()
+	}
+	return err
+}
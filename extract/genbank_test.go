@@ -0,0 +1,102 @@
+package extract
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// Two records. The second is a protein with a continued ACCESSION line.
+const genbankRecords = `LOCUS       AB000001                 120 bp    DNA     linear   BCT 01-JAN-2000
+DEFINITION  Some bacterium gene,
+            complete cds.
+ACCESSION   AB000001 AB000005 AB000010-AB000012
+VERSION     AB000001.2
+SOURCE      Some bacterium
+  ORGANISM  Some bacterium
+FEATURES             Location/Qualifiers
+     source          1..120
+                     /db_xref="taxon:562"
+ORIGIN
+        1 acgtacgtac gtacgtacgt
+//
+LOCUS       XP_000002                 80 aa            linear   PLN 01-JAN-2000
+DEFINITION  Some protein.
+ACCESSION   XP_000002
+            XP_000003
+VERSION     XP_000002.1
+//
+`
+
+func TestParseGenbank(t *testing.T) {
+	tests := []struct {
+		withSequence bool
+		want         []GenbankHeader
+	}{
+		{true, []GenbankHeader{{Primary: "AB000001",
+			Secondary: []string{"AB000005"},
+			Ranges:    []string{"AB000010-AB000012"}, Version: "AB000001.2",
+			Division: "BCT", File: "f", Length: 120, MolType: "DNA",
+			Definition: "Some bacterium gene, complete cds.",
+			Organism:   "Some bacterium", Taxid: "562",
+			Sequence: "acgtacgtacgtacgtacgt"},
+			{Primary: "XP_000002", Secondary: []string{"XP_000003"},
+				Version: "XP_000002.1", Division: "PLN", File: "f", Length: 80,
+				MolType: "protein", Definition: "Some protein."}}},
+		{false, nil}, // Checked for no sequence below
+	}
+	for _, tt := range tests {
+		got := []GenbankHeader{}
+		err := ParseGenbank(strings.NewReader(genbankRecords), "f",
+			tt.withSequence, func(h GenbankHeader) error {
+				got = append(got, h)
+				return nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.want == nil {
+			if len(got) != 2 || got[0].Sequence != "" {
+				t.Errorf("Without sequence got %+v", got)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseGenbank() = %+v.\nWant %+v", got, tt.want)
+		}
+	}
+}
+
+func TestParseGenbankErrorLine(t *testing.T) {
+	err := ParseGenbank(strings.NewReader(genbankRecords), "f", false,
+		func(h GenbankHeader) error {
+			if h.Primary == "XP_000002" {
+				return &util.ParseError{Text: h.Primary,
+					Err: errors.New("bad")}
+			}
+			return nil
+		})
+	var parseErr *util.ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != "f" ||
+		parseErr.Line != 14 {
+		t.Errorf("Got error %v. Want a ParseError at f:14", err)
+	}
+}
+
+// Blank lines in ORIGIN are skipped.
+func TestParseGenbankBlankOrigin(t *testing.T) {
+	records := strings.Replace(genbankRecords, "ORIGIN\n",
+		"ORIGIN\n\n   \n", 1)
+	got := ""
+	err := ParseGenbank(strings.NewReader(records), "f", true,
+		func(h GenbankHeader) error {
+			got += h.Sequence
+			return nil
+		})
+	if err != nil || got != "acgtacgtacgtacgtacgt" {
+		t.Errorf("Got %q, %v. Want the sequence", got, err)
+	}
+}
@@ -0,0 +1,123 @@
+package extract
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// A MetaRecord is the sequence info written to the metadata sidecar files
+// alongside the accession lists.
+type MetaRecord struct {
+	Accession  string // Without the version
+	Version    string // E.g. NP_000123.1. Empty if not known
+	Length     int    // Sequence length in bases or residues
+	MolType    string // E.g. DNA, mRNA, protein
+	Definition string // GenBank DEFINITION or FASTA title
+	Organism   string // Organism name if given
+	Taxid      string // NCBI taxonomy ID if given
+}
+
+// MetaColumns are the column names of the metadata sidecar files.
+var MetaColumns = []string{"accession", "version", "length", "mol_type",
+	"definition", "organism", "taxid"}
+
+// A MetaWriter writes metadata records to a tab-separated sidecar file.
+type MetaWriter struct {
+	file *os.File
+	out  *bufio.Writer
+}
+
+// NewMetaWriter creates a sidecar file and writes the column header.
+func NewMetaWriter(path string) (*MetaWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, util.Handle("Error in creating metadata file", err)
+	}
+	w := &MetaWriter{file, bufio.NewWriter(file)}
+	w.out.WriteString(strings.Join(MetaColumns, "\t") + "\n")
+	return w, err
+}
+
+// Write adds a record to the sidecar. Tabs and newlines in the text fields
+// are replaced with spaces.
+func (w *MetaWriter) Write(r MetaRecord) error {
+	clean := func(s string) string {
+		return strings.NewReplacer("\t", " ", "\n", " ").Replace(s)
+	}
+	row := []string{r.Accession, r.Version, strconv.Itoa(r.Length),
+		r.MolType, clean(r.Definition), clean(r.Organism), r.Taxid}
+	_, err := w.out.WriteString(strings.Join(row, "\t") + "\n")
+	return err
+}
+
+// Close flushes and closes the sidecar file.
+func (w *MetaWriter) Close() error {
+	if err := w.out.Flush(); err != nil {
+		w.file.Close()
+		return util.Handle("Error in writing metadata file", err)
+	}
+	return w.file.Close()
+}
+
+// For organism and taxid info in FASTA titles. nr and RefSeq proteins end
+// with [Organism name]. UniProt style titles have OS= and OX= fields.
+var (
+	bracketOrganism = regexp.MustCompile(`\[([^\[\]]+)\]\s*$`)
+	uniprotOrganism = regexp.MustCompile(`OS=(.+?)(?: [A-Z]{2}=|$)`)
+	uniprotTaxid    = regexp.MustCompile(`(?:OX|TaxID)=(\d+)`)
+)
+
+// fastaTitleInfo gets the organism and taxid from a FASTA title if it has
+// them.
+func fastaTitleInfo(title string) (string, string) {
+	var organism, taxid string
+	if m := bracketOrganism.FindStringSubmatch(title); m != nil {
+		organism = m[1]
+	} else if m := uniprotOrganism.FindStringSubmatch(title); m != nil {
+		organism = m[1]
+	}
+	if m := uniprotTaxid.FindStringSubmatch(title); m != nil {
+		taxid = m[1]
+	}
+	return organism, taxid
+}
+
+// fastaMetaRecords makes records for each accession in a FASTA header (more
+// than one for nr) with the total sequence length.
+func fastaMetaRecords(header string, length int, molType string) []MetaRecord {
+	res := []MetaRecord{}
+	for _, entry := range strings.Split(strings.TrimPrefix(header, ">"), "\x01") {
+		fields := strings.SplitN(strings.TrimSpace(entry), " ", 2)
+		if fields[0] == "" {
+			continue
+		}
+		r := MetaRecord{Length: length, MolType: molType}
+		r.Accession = strings.Split(fields[0], ".")[0]
+		if strings.Contains(fields[0], ".") {
+			r.Version = fields[0]
+		}
+		if len(fields) > 1 {
+			r.Definition = fields[1]
+			r.Organism, r.Taxid = fastaTitleInfo(fields[1])
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// fastaMolType guesses the molecule type from a FASTA file name.
+func fastaMolType(file string) string {
+	name := strings.TrimSuffix(file, ".gz")
+	switch {
+	case strings.HasSuffix(name, ".faa"):
+		return "protein"
+	case strings.HasSuffix(name, ".fna"):
+		return "nucleotide"
+	}
+	return ""
+}
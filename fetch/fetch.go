@@ -0,0 +1,138 @@
+// Package fetch downloads NCBI source files from the rsync mirror or the S3
+// copy into a local source_files directory.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// Server is the rsync server files are downloaded from. E.g. the NCBI server
+// or a mirror like mirrors.vbi.vt.edu::ftp.ncbi.nih.gov.
+var Server = "rsync://ftp.ncbi.nlm.nih.gov"
+
+// RsyncTimeout is the longest a single file download can take. nr is about
+// 100 GB.
+var RsyncTimeout = 6 * time.Hour
+
+// Bucket is the S3 bucket with the copy of the NCBI files.
+const Bucket = "czbiohub-ncbi-store"
+
+// LocalPath gives where a remote file is downloaded to under home. E.g.
+// /genbank/gbbct1.seq.gz -> home/source_files/genbank/gbbct1.seq.gz.
+func LocalPath(home string, file string) string {
+	return home + "/source_files" + file
+}
+
+// Rsync downloads the file from remote to LocalPath. Skipped if it's there
+// already. rsync is stopped if ctx is cancelled. It keeps the download in a
+// temp file until it's done, so no partial file is left at LocalPath. Only
+// planned in a dry run. Fails with a *util.DownloadError.
+func Rsync(ctx context.Context, home string, file string) error {
+	var err error
+	dest := LocalPath(home, file)
+	// Skip if file exists
+	if _, err = os.Stat(dest); err == nil {
+		util.Log(ctx).Info("Downloaded already", "file", file)
+		return err
+	}
+	if util.DryRun(ctx) {
+		util.Planned(ctx, util.PlanDownload, Server+file, -1)
+		return nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return util.Handle("Error in making destination dir", err)
+	}
+
+	start := time.Now()
+	rsync := util.Cmd{Args: []string{"rsync", "-arzv", "--no-motd",
+		Server + file, dest}, Timeout: RsyncTimeout}
+	err = util.Run(ctx, nil, rsync)
+	observeDownload(Server, start, dest, err)
+	if err != nil {
+		return util.Handle("Error in downloading file", rsyncError(file, err))
+	}
+	util.Log(ctx).Info("Downloaded", "file", file, "took",
+		time.Since(start).String())
+	return err
+}
+
+// observeDownload records the time and size of a download from a mirror.
+func observeDownload(mirror string, start time.Time, dest string,
+	err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	metrics.DownloadSeconds.WithLabelValues(mirror, result).Observe(
+		time.Since(start).Seconds())
+	if info, statErr := os.Stat(dest); err == nil && statErr == nil {
+		metrics.DownloadBytes.WithLabelValues(mirror).Add(float64(info.Size()))
+	}
+}
+
+// rsyncError makes a failed rsync into a *util.DownloadError. Files missing
+// on the server also match util.ErrNotFound.
+func rsyncError(file string, err error) error {
+	var toolErr *util.ExternalToolError
+	if errors.As(err, &toolErr) &&
+		strings.Contains(toolErr.Stderr, "No such file or directory") {
+		err = &util.NotFoundError{What: "remote file", Name: Server + file,
+			Err: err}
+	}
+	return &util.DownloadError{Source: Server, File: file, Err: err}
+}
+
+// S3 downloads a file from the S3 bucket to source_files in the working
+// directory. Skipped if it's there already. A partial file is removed if the
+// download fails or ctx is cancelled. Only planned in a dry run.
+func S3(ctx context.Context, downloader *s3manager.Downloader,
+	file string) error {
+	var err error
+	// Skip if file exists
+	if _, err = os.Stat("source_files" + file); err == nil {
+		util.Log(ctx).Info("Downloaded already", "file", file)
+		return err
+	}
+	if util.DryRun(ctx) {
+		util.Planned(ctx, util.PlanDownload, "s3://"+Bucket+file, -1)
+		return nil
+	}
+
+	dir := filepath.Dir(file)
+	if err = os.MkdirAll("source_files"+dir, os.ModePerm); err != nil {
+		return util.Handle("Error in making source_files dir", err)
+	}
+	to_create := "source_files" + file
+	util.Log(ctx).Debug("Creating file", "path", to_create)
+	f, err := os.Create(to_create)
+	if err != nil {
+		return util.Handle("Failed to create file: "+to_create, err)
+	}
+	defer f.Close()
+	start := time.Now()
+	_, err = downloader.DownloadWithContext(ctx, f, &s3.GetObjectInput{
+		Bucket: aws.String(Bucket),
+		Key:    aws.String(file),
+	})
+	observeDownload("s3://"+Bucket, start, to_create, err)
+	if err != nil {
+		f.Close()
+		os.Remove(to_create)
+		err = &util.DownloadError{Source: "s3://" + Bucket, File: file, Err: err}
+		return util.Handle("Error in downloading file from S3", err)
+	}
+	util.Log(ctx).Info("Downloaded", "file", file, "source", "s3")
+	return err
+}
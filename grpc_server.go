@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// gRPC version of the lookup server for large batch clients. Messages are
+// defined in lookup.proto and encoded by hand with protowire, so clients
+// generated from lookup.proto work without generated code here.
+
+// Request and response messages from lookup.proto.
+type lookupRequest struct {
+	accession string
+	prefix    string // Range, if accession is empty
+	start     int64
+	end       int64
+}
+
+type lookupResponse struct {
+	seq     uint64
+	query   string
+	matches []lookupMatch
+	err     string
+}
+
+// query gives the request in the form search.ParseQuery takes.
+func (r *lookupRequest) query() string {
+	if r.accession != "" {
+		return r.accession
+	}
+	return fmt.Sprintf("%s%d-%d", r.prefix, r.start, r.end)
+}
+
+// lookupStreamer is implemented by servers of the AccessionLookup service.
+type lookupStreamer interface {
+	lookupStream(stream grpc.ServerStream) error
+}
+
+// Full method name for clients.
+const lookupMethod = "/ncbisearch.AccessionLookup/Lookup"
+
+var lookupServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ncbisearch.AccessionLookup",
+	HandlerType: (*lookupStreamer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Lookup",
+		ServerStreams: true,
+		ClientStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(lookupStreamer).lookupStream(stream)
+		},
+	}},
+	Metadata: "lookup.proto",
+}
+
+// newGrpcServer makes a gRPC server for the lookup server's index. The index
+// (and its reloads) are shared with the HTTP endpoints.
+func newGrpcServer(s *lookupServer) *grpc.Server {
+	server := grpc.NewServer(grpc.ForceServerCodec(lookupCodec{}))
+	server.RegisterService(&lookupServiceDesc, s)
+	return server
+}
+
+// serveGrpc serves gRPC lookups with server on addr until it fails or is
+// stopped.
+func serveGrpc(server *grpc.Server, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return util.Handle("Error in listening on "+addr, err)
+	}
+	slog.Info("Serving gRPC lookups", "addr", addr)
+	return server.Serve(listener)
+}
+
+// lookupStream answers each request on the stream in order until the client
+// closes its side. Lookups stop if the client goes away or the server is
+// stopped.
+func (s *lookupServer) lookupStream(stream grpc.ServerStream) error {
+	for seq := uint64(0); ; seq++ {
+		req := &lookupRequest{}
+		if err := stream.RecvMsg(req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		r := s.answer(stream.Context(), []string{req.query()})[0]
+		resp := &lookupResponse{seq, r.Query, r.Matches, r.Error}
+		if err := stream.SendMsg(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// lookupCodec encodes the lookup.proto messages in the protobuf wire format.
+type lookupCodec struct{}
+
+func (lookupCodec) Name() string {
+	return "proto"
+}
+
+func (lookupCodec) Marshal(v interface{}) ([]byte, error) {
+	var b []byte
+	switch m := v.(type) {
+	case *lookupRequest:
+		if m.accession != "" {
+			b = appendString(b, 1, m.accession)
+		} else {
+			var r []byte
+			r = appendString(r, 1, m.prefix)
+			r = protowire.AppendTag(r, 2, protowire.VarintType)
+			r = protowire.AppendVarint(r, uint64(m.start))
+			r = protowire.AppendTag(r, 3, protowire.VarintType)
+			r = protowire.AppendVarint(r, uint64(m.end))
+			b = protowire.AppendTag(b, 2, protowire.BytesType)
+			b = protowire.AppendBytes(b, r)
+		}
+	case *lookupResponse:
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.seq)
+		b = appendString(b, 2, m.query)
+		for _, match := range m.matches {
+			var mb []byte
+			mb = appendString(mb, 1, match.Found)
+			mb = appendString(mb, 2, match.Collection)
+			mb = appendString(mb, 3, match.File)
+			b = protowire.AppendTag(b, 3, protowire.BytesType)
+			b = protowire.AppendBytes(b, mb)
+		}
+		b = appendString(b, 4, m.err)
+	default:
+		return nil, fmt.Errorf("can't marshal %T", v)
+	}
+	return b, nil
+}
+
+func (lookupCodec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case *lookupRequest:
+		return eachField(data, func(num protowire.Number, val []byte,
+			n uint64) error {
+			switch num {
+			case 1:
+				m.accession = string(val)
+			case 2:
+				return eachField(val, func(num protowire.Number, val []byte,
+					n uint64) error {
+					switch num {
+					case 1:
+						m.prefix = string(val)
+					case 2:
+						m.start = int64(n)
+					case 3:
+						m.end = int64(n)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	case *lookupResponse:
+		return eachField(data, func(num protowire.Number, val []byte,
+			n uint64) error {
+			switch num {
+			case 1:
+				m.seq = n
+			case 2:
+				m.query = string(val)
+			case 3:
+				match := lookupMatch{}
+				err := eachField(val, func(num protowire.Number, val []byte,
+					n uint64) error {
+					switch num {
+					case 1:
+						match.Found = string(val)
+					case 2:
+						match.Collection = string(val)
+					case 3:
+						match.File = string(val)
+					}
+					return nil
+				})
+				m.matches = append(m.matches, match)
+				return err
+			case 4:
+				m.err = string(val)
+			}
+			return nil
+		})
+	}
+	return fmt.Errorf("can't unmarshal %T", v)
+}
+
+// Appends a string field. Empty strings are left out like proto3 does.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// eachField calls fn with the number and value of each field in a message.
+// Length-delimited values come in val, varints in n. Other types are skipped.
+func eachField(data []byte, fn func(num protowire.Number, val []byte,
+	n uint64) error) error {
+	for len(data) > 0 {
+		num, typ, size := protowire.ConsumeTag(data)
+		if size < 0 {
+			return protowire.ParseError(size)
+		}
+		data = data[size:]
+		var val []byte
+		var n uint64
+		switch typ {
+		case protowire.BytesType:
+			val, size = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			n, size = protowire.ConsumeVarint(data)
+		default:
+			size = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if size < 0 {
+			return protowire.ParseError(size)
+		}
+		data = data[size:]
+		if err := fn(num, val, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
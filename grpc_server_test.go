@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeLookups answers lookups from a map of query inputs to matches.
+type fakeLookups map[string][]search.Match
+
+func (f fakeLookups) Lookup(ctx context.Context, q search.Query) (
+	[]search.Match, error) {
+	return f[q.Input], nil
+}
+
+// Streams a few queries through the gRPC service over an in-memory listener
+// and checks the responses come back in order.
+func TestGrpcLookupStream(t *testing.T) {
+	s := &lookupServer{searcher: fakeLookups{
+		"NM_000014": {{Found: "14", Collection: "refseq", File: "/a"}},
+		"XP_5000-6000": {{Found: "4000-5500", Collection: "refseq",
+			File: "/b"}, {Found: "5999", Collection: "genbank", File: "/c"}},
+	}}
+	listener := bufconn.Listen(1024 * 1024)
+	server := newGrpcServer(s)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(lookupCodec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := conn.NewStream(context.Background(),
+		&lookupServiceDesc.Streams[0], lookupMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		req     *lookupRequest
+		matches []lookupMatch
+		isErr   bool
+	}{
+		{&lookupRequest{accession: "NM_000014"},
+			[]lookupMatch{{"14", "refseq", "/a"}}, false},
+		{&lookupRequest{prefix: "XP_", start: 5000, end: 6000},
+			[]lookupMatch{{"4000-5500", "refseq", "/b"},
+				{"5999", "genbank", "/c"}}, false},
+		{&lookupRequest{accession: "NM_*"}, nil, false},
+		{&lookupRequest{accession: "not an accession"}, nil, true},
+	}
+	go func() {
+		for _, tt := range tests {
+			stream.SendMsg(tt.req)
+		}
+		stream.CloseSend()
+	}()
+	for i, tt := range tests {
+		resp := &lookupResponse{}
+		if err = stream.RecvMsg(resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.seq != uint64(i) || resp.query != tt.req.query() {
+			t.Fatalf("Response %d is for %d %q. Want %q", i, resp.seq,
+				resp.query, tt.req.query())
+		}
+		if !reflect.DeepEqual(resp.matches, tt.matches) ||
+			(resp.err != "") != tt.isErr {
+			t.Errorf("Got %v, %q for %q. Want %v, error %v", resp.matches,
+				resp.err, resp.query, tt.matches, tt.isErr)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// lookupCommand answers ad hoc queries from args, or from in (one per line)
+// if there are no args. Writes the file, matched range, and collection of
+// each hit to out. Stops reading from in if ctx is cancelled.
+func lookupCommand(ctx context.Context, args []string, in io.Reader,
+	out io.Writer) error {
+	searcher, err := newSearcher(util.UserHome())
+	if err != nil {
+		return util.Handle("Error in setting up search", err)
+	}
+	answer := func(input string) {
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return
+		}
+		q, err := search.ParseQuery(input)
+		if err != nil {
+			fmt.Fprintf(out, "%-15s | error: %s\n", input, err)
+			return
+		}
+		res, err := searcher.Lookup(ctx, q)
+		if err != nil {
+			fmt.Fprintf(out, "%-15s | error: %s\n", input, err)
+			return
+		}
+		if len(res) == 0 {
+			metrics.NotFound.WithLabelValues("lookup").Inc()
+			fmt.Fprintf(out, "%-15s | not found\n", input)
+		}
+		for _, m := range res {
+			fmt.Fprintf(out, "%-15s | %s\n", input, m)
+		}
+	}
+
+	if len(args) > 0 {
+		for _, arg := range args {
+			answer(arg)
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		answer(scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return util.Handle("Error in reading lookups from stdin", err)
+	}
+	return nil
+}
@@ -1,13 +1,136 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
 )
 
+// Which locations to report when an accession is found in more than one file
+// or collection. See search.MatchFirst, MatchAll and MatchPriority.
+var matchMode = flag.String("match", search.MatchFirst,
+	"Locations to report for each accession: first, all, or priority")
+
+// Molecule type of the queries. Collections for the other type are skipped.
+var molType = flag.String("moltype", "",
+	"Molecule type of the queries: nucleotide, protein, or empty for any")
+
+// Prefix cache settings. Evicted results are kept on disk if a spill
+// directory is given.
+var cacheMB = flag.Int64("cache-mb", 1024,
+	"Memory budget in MB for cached prefix search results")
+var cacheSpill = flag.String("cache-spill", "",
+	"Directory for prefix results evicted from the cache. Cleared on start")
+
+// Write the links from nr member accessions to their representative
+// accessions when extracting FASTA accessions.
+var nrLinks = flag.Bool("nr-links", false,
+	"Write member to representative accession links for nr headers")
+
+// Write a metadata sidecar (length, molecule type, definition, organism,
+// taxid) for each source file when extracting accessions.
+var metadata = flag.Bool("metadata", false,
+	"Write sequence metadata sidecar files when extracting accessions")
+
+// NCBI accession2taxid files (comma-separated) for adding taxids to the
+// match results.
+var taxidFiles = flag.String("taxid-files", "",
+	"Comma-separated accession2taxid files for taxids in match results")
+
+// Files with current accession.version values (GenBank .headers.tsv sidecars
+// or accession2taxid files) for diagnosing version mismatches.
+var versionFiles = flag.String("version-files", "",
+	"Comma-separated files of current accession versions for diagnosis")
+
+// Lookup server settings. The index is reloaded when the publish file
+// changes.
+var addr = flag.String("addr", ":8080", "Address for the lookup server")
+var grpcAddr = flag.String("grpc-addr", "",
+	"Address for the gRPC lookup server (off if empty)")
+var publishFile = flag.String("publish-file", "",
+	"File touched when a new index is published (default collections.json)")
+
+// Logging settings. Diagnostics go to stderr. Data output (results,
+// reports, lookups) goes to stdout.
+var logFormat = flag.String("log-format", "text", "Log format: text or json")
+var logLevel = flag.String("log-level", "info",
+	"Log level: debug, info, warn, or error")
+var quiet = flag.Bool("quiet", false, "Only log warnings and errors")
+
+// Where batch runs dump their metrics when done. JSON if the name ends in
+// .json, otherwise the Prometheus text format. The server serves them at
+// /metrics instead.
+var metricsFile = flag.String("metrics-file", "",
+	"File to write the run's metrics to (.json for JSON, else Prometheus text)")
+
+// Files for the subset command. Default to the nr run's files under
+// ~/sequence_lists/blast/db/FASTA.
+var subsetQueries = flag.String("subset-queries", "",
+	"Query accessions to build the subset FASTA for")
+var subsetResults = flag.String("subset-results", "",
+	"Match results of the queries, for the source files to use")
+var subsetOut = flag.String("subset-out", "",
+	"Subset FASTA to write. Missing queries go to OUT.missing.txt")
+
+// Report what each stage would list, download, create, or overwrite, with
+// estimated sizes, instead of doing it. The plan goes to stdout.
+var dryRun = flag.Bool("dry-run", false,
+	"Print what would be listed, downloaded, or written without doing it")
+
 func main() {
+	flag.Parse()
 	// Set up logging
-	log.SetOutput(os.Stderr)
-	log.SetOutput(os.Stdout)
-	log.SetFlags(log.LstdFlags)
+	err := util.SetupLogging(logOut, *logFormat, *logLevel, *quiet)
+	if err != nil {
+		fatal(err)
+	}
+	ctx, stop := signalContext()
+	defer stop()
+	plan := &util.Plan{}
+	if *dryRun {
+		ctx = util.WithPlanStage(util.WithPlan(ctx, plan), flag.Arg(0))
+	}
+
+	// Commands
+	switch flag.Arg(0) {
+	case "":
+	case "lookup":
+		// lookup NM_000123 XP_5000-XP_6000 NM_* or one per line on stdin
+		err = lookupCommand(ctx, flag.Args()[1:], os.Stdin, os.Stdout)
+	case "serve":
+		err = serveCommand(ctx, *addr, *grpcAddr)
+	case "subset":
+		// subset, with -subset-queries, -subset-results, and -subset-out
+		err = subsetCommand(ctx, *subsetQueries, *subsetResults, *subsetOut)
+	case "pipeline":
+		// pipeline pipeline.yaml, with -from, -to, and -force
+		err = pipelineCommand(ctx, flag.Arg(1))
+	default:
+		err = fmt.Errorf("unknown command: %s", flag.Arg(0))
+	}
+	if *metricsFile != "" && *dryRun {
+		util.PlannedOutput(ctx, *metricsFile, -1)
+	} else if *metricsFile != "" {
+		if mErr := metrics.WriteFile(*metricsFile); mErr != nil {
+			util.Handle("Error in writing metrics file", mErr)
+		}
+	}
+	if err != nil {
+		stop()
+		fatal(err)
+	}
+	if *dryRun {
+		plan.Write(os.Stdout)
+	}
+}
+
+// fatal logs an error and exits.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
 }
@@ -0,0 +1,174 @@
+// Package metrics has the Prometheus counters and histograms for downloads,
+// extraction, lookups, and the prefix cache. The lookup server serves them
+// at /metrics (see Handler), and batch runs can dump them to a file with
+// WriteFile.
+//
+// Example:
+//
+//	start := time.Now()
+//	...
+//	metrics.LookupSeconds.WithLabelValues("range").Observe(
+//	    time.Since(start).Seconds())
+//	err := metrics.WriteFile(home + "/run_1.metrics.json")
+package metrics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Registry has the metrics of this package, without the Go runtime ones.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// DownloadBytes counts the bytes of source files downloaded by mirror.
+	DownloadBytes = newCounter("download_bytes_total",
+		"Bytes of source files downloaded.", "mirror")
+	// DownloadSeconds has how long downloads took by mirror and result (ok
+	// or error).
+	DownloadSeconds = newHistogram("download_seconds",
+		"Time taken by source file downloads.",
+		prometheus.ExponentialBuckets(1, 4, 8), "mirror", "result")
+	// ExtractBytes counts the bytes of source files extracted by format.
+	// Throughput is this over the sum of ExtractSeconds.
+	ExtractBytes = newCounter("extract_bytes_total",
+		"Bytes of (compressed) source files extracted.", "format")
+	// ExtractSeconds has how long extracting each file took by format.
+	ExtractSeconds = newHistogram("extract_seconds",
+		"Time taken extracting accessions from a source file.",
+		prometheus.ExponentialBuckets(1, 4, 8), "format")
+	// AccessionsEmitted counts the accessions written to accession lists by
+	// source file format.
+	AccessionsEmitted = newCounter("accessions_emitted_total",
+		"Accessions written to accession lists.", "format")
+	// LookupSeconds has the latency of ad hoc lookups by kind (single,
+	// range, or wildcard).
+	LookupSeconds = newHistogram("lookup_seconds",
+		"Time taken by ad hoc lookups.",
+		prometheus.ExponentialBuckets(0.0005, 4, 10), "kind")
+	// CacheLookups counts prefix cache lookups by result (hit, spill_hit, or
+	// miss). The hit rate is the hits over the total.
+	CacheLookups = newCounter("cache_lookups_total",
+		"Prefix result cache lookups.", "result")
+	// NotFound counts queried sequences that weren't found, by source
+	// (match, lookup).
+	NotFound = newCounter("not_found_total",
+		"Queried sequences not found in any collection.", "source")
+)
+
+// Makes and registers a counter with labels.
+func newCounter(name string, help string,
+	labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: "ncbi",
+		Name: name, Help: help}, labels)
+	Registry.MustRegister(c)
+	return c
+}
+
+// Makes and registers a histogram with labels.
+func newHistogram(name string, help string, buckets []float64,
+	labels ...string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ncbi", Name: name, Help: help, Buckets: buckets}, labels)
+	Registry.MustRegister(h)
+	return h
+}
+
+// Handler serves the metrics, plus the Go runtime and process ones, in the
+// Prometheus format.
+func Handler() http.Handler {
+	gatherers := prometheus.Gatherers{Registry, prometheus.DefaultGatherer}
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+}
+
+// Total gives the sum of a counter over all its label values. E.g. the
+// accessions emitted so far for a progress report.
+func Total(c *prometheus.CounterVec) float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	res := 0.0
+	for m := range ch {
+		var d dto.Metric
+		if err := m.Write(&d); err == nil && d.Counter != nil {
+			res += d.Counter.GetValue()
+		}
+	}
+	return res
+}
+
+// WriteFile dumps the metrics to path. JSON if path ends in .json, otherwise
+// the Prometheus text format (e.g. for the node_exporter textfile
+// collector).
+func WriteFile(path string) error {
+	if !strings.HasSuffix(path, ".json") {
+		return prometheus.WriteToTextfile(path, Registry)
+	}
+	families, err := Registry.Gather()
+	if err != nil {
+		return err
+	}
+	res := []jsonFamily{}
+	for _, mf := range families {
+		res = append(res, toJSON(mf))
+	}
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// A jsonFamily is a metric with all its label values, for the JSON dump.
+type jsonFamily struct {
+	Name    string       `json:"name"`
+	Help    string       `json:"help"`
+	Type    string       `json:"type"`
+	Metrics []jsonMetric `json:"metrics"`
+}
+
+// A jsonMetric is the value of a metric for one set of label values.
+// Histograms have Count, Sum, and the cumulative Buckets by upper bound.
+type jsonMetric struct {
+	Labels  map[string]string `json:"labels"`
+	Value   *float64          `json:"value,omitempty"`
+	Count   *uint64           `json:"count,omitempty"`
+	Sum     *float64          `json:"sum,omitempty"`
+	Buckets map[string]uint64 `json:"buckets,omitempty"`
+}
+
+// Converts a gathered metric family for the JSON dump.
+func toJSON(mf *dto.MetricFamily) jsonFamily {
+	res := jsonFamily{Name: mf.GetName(), Help: mf.GetHelp(),
+		Type: strings.ToLower(mf.GetType().String())}
+	for _, m := range mf.GetMetric() {
+		jm := jsonMetric{Labels: make(map[string]string)}
+		for _, l := range m.GetLabel() {
+			jm.Labels[l.GetName()] = l.GetValue()
+		}
+		switch {
+		case m.Counter != nil:
+			jm.Value = m.Counter.Value
+		case m.Gauge != nil:
+			jm.Value = m.Gauge.Value
+		case m.Histogram != nil:
+			jm.Count, jm.Sum = m.Histogram.SampleCount, m.Histogram.SampleSum
+			jm.Buckets = make(map[string]uint64)
+			for _, b := range m.Histogram.GetBucket() {
+				le := strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64)
+				jm.Buckets[le] = b.GetCumulativeCount()
+			}
+		}
+		res.Metrics = append(res.Metrics, jm)
+	}
+	return res
+}
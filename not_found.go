@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/ranges"
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// Reasons a sequence wasn't found, from diagnoseNotFound.
+const (
+	diagUnknownPrefix   = "unknown prefix"   // No collection has the prefix
+	diagVersionMismatch = "version mismatch" // Known at a different version
+	diagOutOfRange      = "outside ranges"   // Prefix known, number isn't
+)
+
+// writeNotFound writes all the sequences that weren't found to a file in the
+// reduced range form. E.g. XP_: 100-150. It can be used as an input to
+// matchSequences again.
+func writeNotFound(run *matchRun, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return util.Handle("Error in creating not found file", err)
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+	for _, prefix := range accession.SortedPrefixes(run.notFound) {
+		for _, val := range ranges.Reduce(run.notFound[prefix]) {
+			out.WriteString(fmt.Sprintf("%s: %s\n", prefix, val))
+		}
+	}
+	if err = out.Flush(); err != nil {
+		return util.Handle("Error in writing not found file", err)
+	}
+	return err
+}
+
+// loadVersionIndex reads the current versions of accessions from GenBank
+// .headers.tsv sidecars or accession2taxid files. Both have accession.version
+// in the second column.
+func loadVersionIndex(ctx context.Context, paths []string) (map[string]string,
+	error) {
+	res := make(map[string]string)
+	for _, path := range paths {
+		reader, closer, err := accession.OpenInput(path)
+		if err != nil {
+			return res, util.Handle("Error in opening version file", err)
+		}
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() && ctx.Err() == nil {
+			cols := strings.Split(scanner.Text(), "\t")
+			if len(cols) < 2 {
+				continue
+			}
+			p := strings.Split(cols[1], ".")
+			prefix, num, err := accession.Split(p[0])
+			if len(p) < 2 || err != nil || prefix == "" {
+				continue // Header or no version
+			}
+			res[accession.Key(prefix, num)] = p[1]
+		}
+		err = scanner.Err()
+		closer()
+		if err != nil {
+			return res, util.Handle("Error in reading version file "+path, err)
+		}
+		if err = ctx.Err(); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// diagnoseNotFound classifies each sequence that wasn't found as an unknown
+// prefix, a version mismatch, or a number outside all the ranges for a known
+// prefix, and writes the results to path. Unknown prefixes are written as
+// ranges. The summary shows which prefixes are missing the most, to guide
+// which NCBI collections to add next.
+func diagnoseNotFound(ctx context.Context, run *matchRun,
+	versions map[string]string, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return util.Handle("Error in creating diagnosis file", err)
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+	counts := make(map[string]int)
+	unknownPrefixes := make(map[string]int)
+
+	for _, prefix := range accession.SortedPrefixes(run.notFound) {
+		nums := run.notFound[prefix]
+		results, err := run.searcher.RoutedResults(ctx, prefix)
+		if err != nil {
+			return util.Handle("Error in getting results for "+prefix, err)
+		}
+		if len(results) == 0 {
+			for _, val := range ranges.Reduce(nums) {
+				out.WriteString(fmt.Sprintf("%s%s\t%s\n", prefix, val,
+					diagUnknownPrefix))
+			}
+			counts[diagUnknownPrefix] += len(nums)
+			unknownPrefixes[prefix] += len(nums)
+			continue
+		}
+		for _, num := range nums {
+			key := accession.Key(prefix, num)
+			queried, current := run.queryVersions[key], versions[key]
+			if queried != "" && current != "" && queried != current {
+				out.WriteString(fmt.Sprintf("%s\t%s\tqueried .%s, current .%s\n",
+					key, diagVersionMismatch, queried, current))
+				counts[diagVersionMismatch]++
+				continue
+			}
+			out.WriteString(fmt.Sprintf("%s\t%s\t%s\n", key, diagOutOfRange,
+				nearestRanges(results, num)))
+			counts[diagOutOfRange]++
+		}
+	}
+	if err = out.Flush(); err != nil {
+		return util.Handle("Error in writing diagnosis file", err)
+	}
+
+	// Summary
+	fmt.Println("NOT FOUND DIAGNOSIS:")
+	for _, reason := range []string{diagUnknownPrefix, diagVersionMismatch,
+		diagOutOfRange} {
+		fmt.Println(reason + ": " + strconv.Itoa(counts[reason]))
+	}
+	if len(unknownPrefixes) > 0 {
+		fmt.Println("UNKNOWN PREFIXES:")
+		prefixes := []string{}
+		for k := range unknownPrefixes {
+			prefixes = append(prefixes, k)
+		}
+		sort.Slice(prefixes, func(i, j int) bool {
+			a, b := unknownPrefixes[prefixes[i]], unknownPrefixes[prefixes[j]]
+			if a != b {
+				return a > b
+			}
+			return prefixes[i] < prefixes[j]
+		})
+		for _, k := range prefixes {
+			fmt.Println(k + ": " + strconv.Itoa(unknownPrefixes[k]))
+		}
+	}
+	return err
+}
+
+// nearestRanges describes the closest intervals below and above num in each
+// collection. E.g. "refseq: 1-99 < n < 120-150".
+func nearestRanges(results map[string]search.Result, num int) string {
+	names := []string{}
+	for k := range results {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	parts := []string{}
+	for _, name := range names {
+		intervals := results[name].Intervals
+		i := sort.Search(len(intervals), func(i int) bool {
+			return intervals[i].Start > num
+		})
+		below, above := "start", "end"
+		if i > 0 {
+			below = intervals[i-1].String()
+		}
+		if i < len(intervals) {
+			above = intervals[i].String()
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s < n < %s", name, below, above))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,279 @@
+// Package pipeline runs a declarative pipeline of stages (e.g. extract, trim,
+// reduce, prefix inventory, match) from a YAML file. Stages run in
+// dependency order, and stages whose definition and input contents haven't
+// changed since their last successful run are skipped.
+//
+// Example pipeline file:
+//
+//	stages:
+//	  - name: reduce
+//	    action: reduce
+//	    inputs: [~/sequence_lists/nr.trimmed.sorted.txt]
+//	    outputs: [~/sequence_lists/nr.reduced.txt]
+//	  - name: match
+//	    action: match
+//	    inputs: [~/sequence_lists/nr.reduced.txt]
+//	    outputs: [~/sequence_lists/nr_run_1.txt]
+//
+// Example run:
+//
+//	p, err := pipeline.Load(path)
+//	r := &pipeline.Runner{Actions: actions}
+//	err = r.Run(ctx, p, "reduce", "")
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+	"gopkg.in/yaml.v3"
+)
+
+// A Stage is a step of the pipeline. It runs a registered action (see
+// Runner) or an external command. A stage depends on the stages in Needs and
+// on the stages whose outputs are its inputs. A command's Stdout file counts
+// as one of its outputs.
+type Stage struct {
+	Name    string   `yaml:"name"`
+	Action  string   `yaml:"action,omitempty"`  // Registered action
+	Command []string `yaml:"command,omitempty"` // Or an argv to run
+	Stdout  string   `yaml:"stdout,omitempty"`  // Command output file
+	Needs   []string `yaml:"needs,omitempty"`   // Other dependencies
+	Inputs  []string `yaml:"inputs,omitempty"`  // Files or folders
+	Outputs []string `yaml:"outputs,omitempty"` // Files or folders
+}
+
+// A Pipeline is the stages from a pipeline file in dependency order.
+type Pipeline struct {
+	Stages []Stage `yaml:"stages"`
+	// File for the state of the last runs. Default is the pipeline file
+	// with .state.json added.
+	State string `yaml:"state,omitempty"`
+
+	deps map[string][]string // Dependencies of each stage
+}
+
+// Load reads and checks a pipeline file. Paths starting with ~/ are in the
+// home directory. Fails with a *util.ParseError if stages are missing names,
+// have unknown dependencies, or depend on each other in a cycle.
+func Load(path string) (*Pipeline, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, &util.NotFoundError{What: "pipeline file", Name: path,
+			Err: err}
+	} else if err != nil {
+		return nil, util.Handle("Error in reading pipeline file", err)
+	}
+	p := &Pipeline{}
+	if err = yaml.Unmarshal(data, p); err != nil {
+		return nil, &util.ParseError{File: path, Err: err}
+	}
+	if p.State == "" {
+		p.State = path + ".state.json"
+	}
+	p.State = expandHome(p.State)
+	for i := range p.Stages {
+		s := &p.Stages[i]
+		for j := range s.Inputs {
+			s.Inputs[j] = expandHome(s.Inputs[j])
+		}
+		for j := range s.Outputs {
+			s.Outputs[j] = expandHome(s.Outputs[j])
+		}
+		for j := range s.Command {
+			s.Command[j] = expandHome(s.Command[j])
+		}
+		if s.Stdout != "" {
+			s.Stdout = expandHome(s.Stdout)
+			s.Outputs = appendNew(s.Outputs, s.Stdout)
+		}
+	}
+	if err = p.sort(); err != nil {
+		return nil, &util.ParseError{File: path, Err: err}
+	}
+	return p, err
+}
+
+// Expands a leading ~/ to the home directory.
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return util.UserHome() + path[1:]
+	}
+	return path
+}
+
+// Appends a path to a list if it isn't there already.
+func appendNew(paths []string, path string) []string {
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return paths
+		}
+	}
+	return append(paths, path)
+}
+
+// Finds the dependencies of each stage and orders the stages so each one
+// comes after its dependencies. Otherwise keeps the order of the file.
+func (p *Pipeline) sort() error {
+	byName := make(map[string]int)
+	producer := make(map[string]string) // Stage writing each output
+	for i, s := range p.Stages {
+		if s.Name == "" {
+			return fmt.Errorf("stage %d has no name", i+1)
+		}
+		if _, present := byName[s.Name]; present {
+			return fmt.Errorf("stage %s is defined twice", s.Name)
+		}
+		if (s.Action == "") == (len(s.Command) == 0) {
+			return fmt.Errorf("stage %s needs one of action or command",
+				s.Name)
+		}
+		byName[s.Name] = i
+		for _, out := range s.Outputs {
+			if other, present := producer[filepath.Clean(out)]; present {
+				return fmt.Errorf("stages %s and %s both write %s", other,
+					s.Name, out)
+			}
+			producer[filepath.Clean(out)] = s.Name
+		}
+	}
+
+	p.deps = make(map[string][]string)
+	for _, s := range p.Stages {
+		seen := make(map[string]bool)
+		for _, dep := range s.Needs {
+			if _, present := byName[dep]; !present {
+				return fmt.Errorf("stage %s needs unknown stage %s", s.Name,
+					dep)
+			}
+			if !seen[dep] {
+				p.deps[s.Name] = append(p.deps[s.Name], dep)
+				seen[dep] = true
+			}
+		}
+		for _, in := range s.Inputs {
+			dep, present := producer[filepath.Clean(in)]
+			if present && dep != s.Name && !seen[dep] {
+				p.deps[s.Name] = append(p.deps[s.Name], dep)
+				seen[dep] = true
+			}
+		}
+	}
+
+	// Depth-first, visiting the stages in file order.
+	const visiting, done = 1, 2
+	state := make(map[string]int)
+	sorted := []Stage{}
+	path := []string{} // Stages being visited, for cycle errors
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("stages depend on each other in a cycle: %s",
+				strings.Join(append(path, name), " -> "))
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range p.deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		sorted = append(sorted, p.Stages[byName[name]])
+		return nil
+	}
+	for _, s := range p.Stages {
+		if err := visit(s.Name); err != nil {
+			return err
+		}
+	}
+	p.Stages = sorted
+	return nil
+}
+
+// Select gives the stages to run, in dependency order: from a stage and the
+// stages depending on it, up to a stage and the stages it depends on. Empty
+// from or to doesn't limit that side.
+func (p *Pipeline) Select(from string, to string) ([]Stage, error) {
+	for _, name := range []string{from, to} {
+		if name != "" && !p.has(name) {
+			return nil, &util.NotFoundError{What: "stage", Name: name}
+		}
+	}
+	after := p.reachable(from, func(s string) []string {
+		return p.dependents(s)
+	})
+	before := p.reachable(to, func(s string) []string { return p.deps[s] })
+	res := []Stage{}
+	for _, s := range p.Stages {
+		if (from == "" || after[s.Name]) && (to == "" || before[s.Name]) {
+			res = append(res, s)
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("stage %s doesn't come before stage %s", from,
+			to)
+	}
+	return res, nil
+}
+
+// Checks if a stage exists.
+func (p *Pipeline) has(name string) bool {
+	for _, s := range p.Stages {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if a stage depends directly on any of the stages in names.
+func (p *Pipeline) dependsOn(name string, names map[string]bool) bool {
+	for _, dep := range p.deps[name] {
+		if names[dep] {
+			return true
+		}
+	}
+	return false
+}
+
+// Gives the stages that depend directly on a stage.
+func (p *Pipeline) dependents(name string) []string {
+	res := []string{}
+	for _, s := range p.Stages {
+		for _, dep := range p.deps[s.Name] {
+			if dep == name {
+				res = append(res, s.Name)
+			}
+		}
+	}
+	return res
+}
+
+// Gives the stages reachable from start, including itself, following next.
+func (p *Pipeline) reachable(start string,
+	next func(string) []string) map[string]bool {
+	res := make(map[string]bool)
+	if start == "" {
+		return res
+	}
+	queue := []string{start}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if res[cur] {
+			continue
+		}
+		res[cur] = true
+		queue = append(queue, next(cur)...)
+	}
+	return res
+}
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// An Action does the work of a stage, reading its Inputs and writing its
+// Outputs. It should stop when ctx is cancelled.
+type Action func(ctx context.Context, s Stage) error
+
+// A Runner runs the stages of pipelines with its registered actions.
+type Runner struct {
+	Actions map[string]Action // By the action names used in stages
+	Force   bool              // Run stages even if they're unchanged
+}
+
+// Run runs the stages from a stage up to a stage (see Pipeline.Select) in
+// dependency order. A stage is skipped if its definition and input contents
+// are the same as in its last successful run and its outputs exist. Stops at
+// the first stage that fails. The state of the stages that finished is
+// kept, so the next run picks up from the failed stage.
+//
+// In a dry run (see util.DryRun) the stages that would run plan their steps
+// instead, and so do the stages after them, whose inputs would change.
+func (r *Runner) Run(ctx context.Context, p *Pipeline, from string,
+	to string) error {
+	stages, err := p.Select(from, to)
+	if err != nil {
+		return err
+	}
+	for _, s := range stages {
+		if _, present := r.Actions[s.Action]; s.Action != "" && !present {
+			return &util.NotFoundError{What: "action", Name: s.Action}
+		}
+	}
+	state, err := loadState(p.State)
+	if err != nil {
+		return err
+	}
+
+	ran, skipped := 0, 0
+	planned := make(map[string]bool) // Stages that would run in a dry run
+	for _, s := range stages {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		sctx := util.WithLog(ctx, "stage", s.Name)
+		sctx = util.WithPlanStage(sctx, s.Name)
+		if util.DryRun(ctx) && p.dependsOn(s.Name, planned) {
+			// Inputs would be remade by an earlier stage.
+			if err = r.planStage(sctx, s); err != nil {
+				return err
+			}
+			planned[s.Name] = true
+			ran++
+			continue
+		}
+		hash, err := stageHash(s)
+		if err != nil {
+			return util.Handle("Error in checking inputs of stage "+s.Name,
+				err)
+		}
+		if !r.Force && state[s.Name].Hash == hash && outputsExist(s) {
+			util.Log(sctx).Info("Unchanged. Skipping.")
+			for _, out := range s.Outputs {
+				util.Planned(sctx, util.PlanSkip, out, -1)
+			}
+			skipped++
+			continue
+		}
+		if util.DryRun(ctx) {
+			if err = r.planStage(sctx, s); err != nil {
+				return err
+			}
+			planned[s.Name] = true
+			ran++
+			continue
+		}
+
+		start := time.Now()
+		util.Log(sctx).Info("Started")
+		if err = r.runStage(sctx, s); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return util.Handle("Error in running stage "+s.Name, err)
+		}
+		if !outputsExist(s) {
+			return fmt.Errorf("stage %s didn't write all its outputs %v",
+				s.Name, s.Outputs)
+		}
+		state[s.Name] = stageState{Hash: hash, Finished: time.Now()}
+		if err = saveState(p.State, state); err != nil {
+			return err
+		}
+		util.Log(sctx).Info("Finished", "took", time.Since(start).String())
+		ran++
+	}
+	if ctx.Err() != nil {
+		util.Log(ctx).Warn("Pipeline interrupted", "ran", ran,
+			"skipped", skipped, "total", len(stages))
+		return ctx.Err()
+	}
+	msg := "Pipeline finished"
+	if util.DryRun(ctx) {
+		msg = "Pipeline planned"
+	}
+	util.Log(ctx).Info(msg, "ran", ran, "skipped", skipped,
+		"total", len(stages))
+	return nil
+}
+
+// Plans a stage in a dry run. Actions plan their own steps.
+func (r *Runner) planStage(ctx context.Context, s Stage) error {
+	util.Log(ctx).Info("Would run")
+	if s.Action != "" {
+		return r.Actions[s.Action](ctx, s)
+	}
+	util.Planned(ctx, util.PlanRun, util.Command(s.Command...).String(), -1)
+	if s.Stdout != "" {
+		util.PlannedOutput(ctx, s.Stdout, -1)
+	}
+	return nil
+}
+
+// Runs a stage's action or command. Command output goes to the Stdout file
+// if set.
+func (r *Runner) runStage(ctx context.Context, s Stage) error {
+	if s.Action != "" {
+		return r.Actions[s.Action](ctx, s)
+	}
+	if s.Stdout == "" {
+		return util.Run(ctx, nil, util.Command(s.Command...))
+	}
+	out, err := os.Create(s.Stdout)
+	if err != nil {
+		return util.Handle("Error in creating stage output", err)
+	}
+	err = util.Run(ctx, out, util.Command(s.Command...))
+	if cErr := out.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(s.Stdout) // Don't leave a partial output
+	}
+	return err
+}
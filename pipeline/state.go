@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// A stageState is the last successful run of a stage.
+type stageState struct {
+	Hash     string    `json:"hash"` // From stageHash
+	Finished time.Time `json:"finished"`
+}
+
+// Reads the state file. Empty if there's none yet.
+func loadState(path string) (map[string]stageState, error) {
+	res := make(map[string]stageState)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return res, nil
+	} else if err != nil {
+		return res, util.Handle("Error in reading pipeline state", err)
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, &util.ParseError{File: path, Err: err}
+	}
+	return res, err
+}
+
+// Writes the state file. Written to a temp file first so an interrupted
+// write doesn't lose the state of earlier stages.
+func saveState(path string, state map[string]stageState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return util.Handle("Error in writing pipeline state", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return util.Handle("Error in writing pipeline state", err)
+	}
+	return err
+}
+
+// stageHash hashes a stage's definition and the contents of its inputs. If
+// either changes the stage has to run again.
+func stageHash(s Stage) (string, error) {
+	h := sha256.New()
+	def, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	h.Write(def)
+	for _, in := range s.Inputs {
+		if err = hashPath(h, in); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+// Adds the contents of a file, or of every file under a folder with their
+// relative names, to h. Fails with a *util.NotFoundError if it doesn't
+// exist, e.g. an earlier stage wasn't run.
+func hashPath(h io.Writer, path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &util.NotFoundError{What: "stage input", Name: path, Err: err}
+	}
+	// Walk goes in lexical order, so the hash doesn't depend on the listing.
+	return filepath.Walk(path, func(file string, info os.FileInfo,
+		err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", rel, info.Size())
+		f, err := os.Open(file)
+		if err != nil {
+			return util.Handle("Error in hashing stage input", err)
+		}
+		defer f.Close()
+		if _, err = io.Copy(h, f); err != nil {
+			return util.Handle("Error in hashing stage input", err)
+		}
+		return nil
+	})
+}
+
+// Checks that all the outputs of a stage exist.
+func outputsExist(s Stage) bool {
+	for _, out := range s.Outputs {
+		if _, err := os.Stat(out); err != nil {
+			return false
+		}
+	}
+	return true
+}
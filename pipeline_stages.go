@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/pipeline"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// Part of the pipeline to run. Stages whose inputs are unchanged since their
+// last run are skipped unless forced.
+var pipelineFrom = flag.String("from", "",
+	"Pipeline stage to start from, with the stages depending on it")
+var pipelineTo = flag.String("to", "",
+	"Pipeline stage to stop at, with the stages it depends on")
+var pipelineForce = flag.Bool("force", false,
+	"Run pipeline stages even if their inputs are unchanged")
+
+// The actions pipeline stages can run, by name. Per-file actions pair each
+// input with the output at the same position.
+var pipelineActions = map[string]pipeline.Action{
+	// Inputs are source lists of remote files. Results go to
+	// ~/sequence_lists.
+	"extract": extractStage,
+	// Accession lists to point values without versions. E.g. AC1.2 -> AC: 1
+	"trim": func(ctx context.Context, s pipeline.Stage) error {
+		return eachStageFile(ctx, s, func(input string, output string) error {
+			return trimFile(ctx, input, output)
+		})
+	},
+	// Sorted point values to ranges. E.g. AC: 1, AC: 2 -> AC: 1-2
+	"reduce": reduceStage,
+	// Reduced files to the unique prefixes in each.
+	"prefixes": prefixesStage,
+	// Queries (one input) to match results (the first output).
+	"match": matchStage,
+}
+
+// pipelineCommand runs a pipeline file from -from up to -to.
+func pipelineCommand(ctx context.Context, path string) error {
+	p, err := pipeline.Load(path)
+	if err != nil {
+		return util.Handle("Error in loading pipeline", err)
+	}
+	r := &pipeline.Runner{Actions: pipelineActions, Force: *pipelineForce}
+	return r.Run(ctx, p, *pipelineFrom, *pipelineTo)
+}
+
+// Extracts the accessions from the remote files in each source list input.
+func extractStage(ctx context.Context, s pipeline.Stage) error {
+	for _, list := range s.Inputs {
+		if err := extractSourceList(ctx, list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reduces each input file into ranges.
+func reduceStage(ctx context.Context, s pipeline.Stage) error {
+	return eachStageFile(ctx, s, func(input string, output string) error {
+		outFile, err := os.Create(output)
+		if err != nil {
+			return util.Handle("Error in creating out file", err)
+		}
+		return reduceOneFile(ctx, input, outFile)
+	})
+}
+
+// Lists the prefixes in each input file.
+func prefixesStage(ctx context.Context, s pipeline.Stage) error {
+	return eachStageFile(ctx, s, func(input string, output string) error {
+		outFile, err := os.Create(output)
+		if err != nil {
+			return util.Handle("Error in creating out file", err)
+		}
+		err = processFilePrefixes(ctx, input, outFile)
+		if cErr := outFile.Close(); err == nil {
+			err = cErr
+		}
+		return err
+	})
+}
+
+// Matches the queries in the input file. Reports are written next to the
+// results.
+func matchStage(ctx context.Context, s pipeline.Stage) error {
+	if len(s.Inputs) != 1 || len(s.Outputs) == 0 {
+		return fmt.Errorf("stage %s needs one input and an output", s.Name)
+	}
+	return runMatch(ctx, util.UserHome(), s.Inputs[0], s.Outputs[0])
+}
+
+// eachStageFile calls fn with each input file of a per-file stage and the
+// output path for it. A folder input gives the files under it (skipping
+// hidden ones), with the same relative names under the output folder. In a
+// dry run the outputs are only planned, estimated at the input sizes.
+func eachStageFile(ctx context.Context, s pipeline.Stage,
+	fn func(input string, output string) error) error {
+	if len(s.Inputs) != len(s.Outputs) {
+		return fmt.Errorf("stage %s needs an output for each input", s.Name)
+	}
+	for i, input := range s.Inputs {
+		if _, err := os.Stat(input); err != nil && util.DryRun(ctx) {
+			// Made by an earlier stage of the dry run.
+			util.PlannedOutput(ctx, s.Outputs[i], -1)
+			continue
+		}
+		err := filepath.Walk(input, func(path string, info os.FileInfo,
+			err error) error {
+			if err != nil || info.IsDir() ||
+				strings.HasPrefix(info.Name(), ".") {
+				return err
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(input, path)
+			if err != nil {
+				return err
+			}
+			output := filepath.Join(s.Outputs[i], rel)
+			if util.DryRun(ctx) {
+				util.PlannedOutput(ctx, output, info.Size())
+				return nil
+			}
+			err = os.MkdirAll(filepath.Dir(output), os.ModePerm)
+			if err != nil {
+				return util.Handle("Error in making out folder", err)
+			}
+			return fn(path, output)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
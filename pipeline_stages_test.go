@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/pipeline"
+)
+
+// Runs trim -> sort -> reduce of the example pipeline with its paths under a
+// temp dir instead of the home directory.
+func TestExamplePipelineReduce(t *testing.T) {
+	dir := t.TempDir()
+	example, err := ioutil.ReadFile("pipeline.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "pipeline.yaml")
+	data := strings.ReplaceAll(string(example), "~/", dir+"/")
+	if err = ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	folder := filepath.Join(dir, "sequence_lists/blast/db/FASTA")
+	if err = os.MkdirAll(folder, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	// Unsorted, with versions and duplicates. 10 sorts before 2 lexically.
+	accs := "WP_10.1\nWP_2.1\nXP_5.1\nWP_1.1\nWP_3.2\nWP_2.2\n"
+	err = ioutil.WriteFile(filepath.Join(folder, "nr.gz.txt"), []byte(accs),
+		0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := pipeline.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &pipeline.Runner{Actions: pipelineActions}
+	if err = r.Run(context.Background(), p, "trim", "reduce"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(folder,
+		"nr.gz.trimmed.sorted.reduced.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "WP_: 1-3\nWP_: 10\nXP_: 5\n"
+	if string(got) != want {
+		t.Errorf("Reduced to %q. Want %q", got, want)
+	}
+}
@@ -2,63 +2,87 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"github.com/skarademir/naturalsort"
 	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+	"github.com/skarademir/naturalsort"
 )
 
 // Not really used in final search routine but was helpful for learning about
 // the prefxies found in each file.
 
 // Reduces files to just a unique list of prefixes found in each file.
-// Example values on genbank files.
-func prefixExtraction() error {
-	home := getUserHome()
+// Example values on genbank files. Only plans the lists in a dry run.
+func prefixExtraction(ctx context.Context) error {
+	home := util.UserHome()
 	inputDir := home + "/sequence_lists/genbank_reduced"
 	files, err := ioutil.ReadDir(inputDir)
 	if err != nil {
-		return handle("Error in reading directory", err)
+		return util.Handle("Error in reading directory", err)
 	}
 	for _, f := range files {
 		outputDir := home + "/sequence_lists/genbank_prefixes"
+		if util.DryRun(ctx) {
+			util.PlannedOutput(ctx, outputDir+"/"+f.Name(), -1)
+			continue
+		}
 		if err = os.MkdirAll(outputDir, os.ModePerm); err != nil {
-			return handle("Error in making dest folder", err)
+			return util.Handle("Error in making dest folder", err)
 		}
 		outFile, err := os.Create(outputDir + "/" + f.Name())
 		if err != nil {
-			return handle("Error in creating out file", err)
+			return util.Handle("Error in creating out file", err)
+		}
+		err = processFilePrefixes(ctx, inputDir+"/"+f.Name(), outFile)
+		if cErr := outFile.Close(); err == nil {
+			err = cErr
+		}
+		if err != nil {
+			return util.Handle("Error in getting prefixes of "+f.Name(), err)
 		}
-		processFilePrefixes(inputDir+"/"+f.Name(), outFile)
 	}
 	return err
 }
 
-// Gets a unique list of the prefixes found in a single file.
-func prefixExtractionSingle() error {
-	home := getUserHome()
+// Gets a unique list of the prefixes found in a single file. Only plans the
+// list in a dry run.
+func prefixExtractionSingle(ctx context.Context) error {
+	home := util.UserHome()
 	inFile := home + "/sequence_lists/blast/db/FASTA/inFile.txt"
 	outPath := home + "/sequence_lists/blast/db/FASTA/outFile.txt"
+	if util.DryRun(ctx) {
+		util.PlannedOutput(ctx, outPath, -1)
+		return nil
+	}
 	outFile, err := os.Create(outPath)
 	if err != nil {
-		return handle("Error in prefix extraction from file", err)
+		return util.Handle("Error in prefix extraction from file", err)
 	}
-	if err = processFilePrefixes(inFile, outFile); err != nil {
-		return handle("Error in getting file prefixes", err)
+	err = processFilePrefixes(ctx, inFile, outFile)
+	if cErr := outFile.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return util.Handle("Error in getting file prefixes", err)
 	}
 	return err
 }
 
-// Gets the prefixes from a file and writes them to a new out file.
-func processFilePrefixes(pathName string, outFile *os.File) error {
-	fmt.Println("File: " + pathName)
+// Gets the prefixes from a file and writes them to a new out file. Stops if
+// ctx is cancelled.
+func processFilePrefixes(ctx context.Context, pathName string,
+	outFile *os.File) error {
+	util.Log(ctx).Info("Getting prefixes", "file", pathName)
 
 	// Open the file
 	file, err := os.Open(pathName)
 	if err != nil {
-		return handle("Error in opening file", err)
+		return util.Handle("Error in opening file", err)
 	}
 	defer file.Close()
 	scanner := bufio.NewScanner(file)
@@ -67,18 +91,23 @@ func processFilePrefixes(pathName string, outFile *os.File) error {
 
 	// Go line by line
 	for scanner.Scan() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
 		line := scanner.Text()
 		// Get set of seen prefixes
 		if prefix := getPrefix(line); prefix != "" {
 			prefixSet[prefix] = true
 		}
 	}
+	if err = scanner.Err(); err != nil {
+		return util.Handle("Error in scanning lines", err)
+	}
 	// Write results to file
 	for k := range prefixSet {
-		outFile.WriteString(fmt.Sprintf("%s\n", k))
-	}
-	if err = scanner.Err(); err != nil {
-		return handle("Error in scanning lines", err)
+		if _, err = outFile.WriteString(fmt.Sprintf("%s\n", k)); err != nil {
+			return util.Handle("Error in writing prefixes", err)
+		}
 	}
 	return err
 }
@@ -95,10 +124,10 @@ func getPrefix(line string) string {
 // Gets a sorted list of the prefixes from a pre-processed directory
 // structure of files of prefix names.
 func prefixListing() error {
-	inputDir := getUserHome() + "/sequence_lists/genbank_prefixes"
+	inputDir := util.UserHome() + "/sequence_lists/genbank_prefixes"
 	files, err := ioutil.ReadDir(inputDir)
 	if err != nil {
-		return handle("Error in reading dir", err)
+		return util.Handle("Error in reading dir", err)
 	}
 	// Gets a list of the prefixes found in the files and puts them into a
 	// sorted list.
@@ -107,7 +136,7 @@ func prefixListing() error {
 		fname := f.Name()
 		fileResult, err := prefixListForFile(inputDir+"/"+fname, fname)
 		if err != nil {
-			return handle("Error in getting prefix list from file", err)
+			return util.Handle("Error in getting prefix list from file", err)
 		}
 		res = append(res, fileResult)
 	}
@@ -123,7 +152,7 @@ func prefixListForFile(fname string, base string) (string, error) {
 	res := base[:len(base)-4] + ": "
 	file, err := os.Open(fname)
 	if err != nil {
-		return "", handle("Error in opening file", err)
+		return "", util.Handle("Error in opening file", err)
 	}
 	defer file.Close()
 	scanner := bufio.NewScanner(file)
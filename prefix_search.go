@@ -2,48 +2,126 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/ranges"
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
 )
 
-type context struct {
-	searchDirA       string // First search directory to include
-	searchDirB       string // Second search directory to include
-	prefixCache      map[string]prefixResult // Cache of results for prefixes
-	outFile          *os.File // File for writing out results
-	notFoundPrefixes map[string]int // Counts of sequences not found by prefix
-	curPrefix        string // curPrefix for some cache optimization
+// A matchRun has the state of a matchSequences run.
+type matchRun struct {
+	searcher         *search.Searcher           // Searches the collections
+	outFile          *os.File                   // File for writing out results
+	notFoundPrefixes map[string]int             // Counts of sequences not found by prefix
+	inputStats       accession.Stats            // Counts of parsed and skipped input lines
+	members          map[string][]string        // Other accessions in the same nr entry
+	viaMember        int                        // Count of sequences only found by a member
+	taxa             accession.TaxIndex         // Accession to taxid, if loaded
+	notFoundTaxa     map[int]int                // Counts of sequences not found by taxid
+	notFound         map[string][]int           // Sequences not found by prefix
+	queryVersions    map[string]string          // Versions given in the input by accession key
+	coverage         map[string]*prefixCoverage // Query coverage by prefix
+	prog             *progress                  // Queries done, if reported
 }
 
 // Example of a caller function for matching sequences from a big file to
 // smaller files found in the search directories.
-func matchSequencesCaller() error {
-	home := getUserHome()
-	var err error
+func matchSequencesCaller(ctx context.Context) error {
+	home := util.UserHome()
 
 	// Setup
 	input := home + "/sequence_lists/blast/db/FASTA/nr.gz.trimmed.sorted" +
 		".reduced.txt"
 	output := home + "/sequence_lists/blast/db/FASTA/nr_run_1.txt"
-	ctx := context{}
-	ctx.outFile, err = os.Create(output)
+	return runMatch(ctx, home, input, output)
+}
+
+// runMatch matches the sequences in an input file to the search collections.
+// Writes the results to output, the reports to files next to it, and the
+// counts to stdout. Only plans the outputs in a dry run.
+func runMatch(ctx context.Context, home string, input string,
+	output string) error {
+	if util.DryRun(ctx) {
+		size := int64(-1)
+		if info, err := os.Stat(input); err == nil {
+			size = info.Size() // About one result line per query line
+		}
+		util.PlannedOutput(ctx, output, size)
+		for _, report := range []string{".coverage.json", ".coverage.txt",
+			".notfound.txt", ".diagnosis.txt"} {
+			util.PlannedOutput(ctx, output+report, -1)
+		}
+		return nil
+	}
+	searcher, err := newSearcher(home)
+	if err != nil {
+		return util.Handle("Error in setting up search", err)
+	}
+	run := &matchRun{searcher: searcher}
+	run.outFile, err = os.Create(output)
 	if err != nil {
-		return handle("Error in creating outfile", err)
+		return util.Handle("Error in creating outfile", err)
 	}
-	ctx.searchDirA = home + "/sequence_lists/genbank_reduced"
-	ctx.searchDirB = home + "/sequence_lists/refseq_trimmed"
-	ctx.prefixCache = make(map[string]prefixResult)
-	ctx.notFoundPrefixes = make(map[string]int)
-	if err = matchSequences(&ctx, input); err != nil {
-		return handle("Error in running match sequence routine", err)
+	defer run.outFile.Close() // Closed already unless there's an error
+	run.notFoundPrefixes = make(map[string]int)
+	run.members = make(map[string][]string)
+	// Links from extracting nr with -nr-links, to resolve entries through any
+	// of their member accessions.
+	links := home + "/sequence_lists/blast/db/FASTA/nr.gz.links.txt"
+	if _, err = os.Stat(links); err == nil {
+		if err = accession.LoadMemberLinks(ctx, links, run.members); err != nil {
+			return util.Handle("Error in loading nr member links", err)
+		}
+	}
+	run.notFoundTaxa = make(map[int]int)
+	run.notFound = make(map[string][]int)
+	run.queryVersions = make(map[string]string)
+	run.coverage = make(map[string]*prefixCoverage)
+	if err = matchSequences(ctx, run, input); ctx.Err() != nil {
+		// Interrupted. Say how far it got.
+		fmt.Println(run.inputStats)
+		util.Log(ctx).Warn("Interrupted. Results up to here are in the output "+
+			"file.", "output", output)
+		return ctx.Err()
+	} else if err != nil {
+		return util.Handle("Error in running match sequence routine", err)
+	}
+	if err = run.outFile.Close(); err != nil {
+		return util.Handle("Error in closing outfile", err)
+	}
+
+	fmt.Println(run.inputStats)
+	if err = writeCoverageReport(run, output+".coverage"); err != nil {
+		return util.Handle("Error in writing coverage report", err)
+	}
+
+	// Full list of sequences not found, and why
+	if err = writeNotFound(run, output+".notfound.txt"); err != nil {
+		return util.Handle("Error in writing not found list", err)
+	}
+	versions := make(map[string]string)
+	if *versionFiles != "" {
+		paths := strings.Split(*versionFiles, ",")
+		if versions, err = loadVersionIndex(ctx, paths); err != nil {
+			return util.Handle("Error in loading version files", err)
+		}
+	}
+	err = diagnoseNotFound(ctx, run, versions, output+".diagnosis.txt")
+	if err != nil {
+		return util.Handle("Error in diagnosing not found sequences", err)
 	}
 
 	// Prefixes not found and the counts of missing sequences (point values)
 	fmt.Println("NOT FOUND COUNTS:")
 	notFoundTotal := 0
-	for k, v := range ctx.notFoundPrefixes {
+	for k, v := range run.notFoundPrefixes {
 		notFoundTotal += v
 		c := strconv.Itoa(v)
 		fmt.Println(k + ": " + c)
@@ -51,263 +129,336 @@ func matchSequencesCaller() error {
 	// Total number of sequences that weren't matched
 	c := strconv.Itoa(notFoundTotal)
 	fmt.Println("Not found total: " + c)
+	if run.taxa != nil {
+		fmt.Println("NOT FOUND COUNTS BY TAXID:")
+		printTaxidCounts(run.notFoundTaxa)
+	}
+
+	// Sequences found in more than one file or collection. Only known in
+	// all-matches mode, since the others stop at the first collection with a
+	// match.
+	if *matchMode == search.MatchAll {
+		fmt.Println("DUPLICATE LOCATION COUNTS:")
+		dupTotal := 0
+		for k, v := range searcher.Duplicates() {
+			dupTotal += v
+			fmt.Println(k + ": " + strconv.Itoa(v))
+		}
+		fmt.Println("Duplicate total: " + strconv.Itoa(dupTotal))
+	} else {
+		fmt.Println("Duplicate locations are only counted with -match all.")
+	}
+	fmt.Println("Found through nr member accessions: " +
+		strconv.Itoa(run.viaMember))
+	fmt.Println(searcher.CacheStats())
 	return err
 }
 
+// newSearcher sets up the collections, molecule type, match mode, and prefix
+// cache used for searching. From the flags and
+// ~/sequence_lists/collections.json.
+func newSearcher(home string) (*search.Searcher, error) {
+	colls, err := loadCollections(home)
+	if err != nil {
+		return nil, util.Handle("Error in loading search collections", err)
+	}
+	return search.New(search.Config{
+		Collections: colls,
+		MolType:     *molType,
+		MatchMode:   *matchMode,
+		CacheBytes:  *cacheMB << 20,
+		CacheSpill:  *cacheSpill,
+	})
+}
+
+// loadCollections loads the search collections from
+// ~/sequence_lists/collections.json, or the defaults if it doesn't exist.
+func loadCollections(home string) ([]search.Collection, error) {
+	return search.LoadCollections(home+"/sequence_lists/collections.json",
+		home)
+}
+
 // matchSequences reads in accession numbers and ranges from an input file
 // and matches the point values or ranges to the same accession numbers in
-// files in a search directory.
-func matchSequences(ctx *context, input string) error {
-	file, err := os.Open(input)
+// files in a search directory. The input format is auto-detected. Reduced
+// "PREFIX: N" / "PREFIX: A-B" files are streamed. Other formats (accession
+// lists, FASTA, accession2taxid, BLAST tabular) can be unsorted, so they're
+// read in full and reduced into ranges first.
+func matchSequences(ctx context.Context, run *matchRun,
+	input string) error {
+	format, err := accession.DetectFormat(input)
 	if err != nil {
-		return handle("Error in opening input file.", err)
+		return util.Handle("Error in detecting input format.", err)
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
+	run.inputStats = accession.Stats{Format: format}
 
 	// Print header
-	str := fmt.Sprintf("%-15s | %13s | %s", "Target", "Found in range", "In file")
-	writeLine(str, ctx.outFile)
+	str := fmt.Sprintf("%-15s | %13s | %-10s | %s", "Target", "Found in range",
+		"Collection", "In file")
+	if err = writeLine(ctx, str, run.outFile); err != nil {
+		return err
+	}
+
+	if format == accession.FormatReduced {
+		if *taxidFiles != "" {
+			prefixes, err := reducedPrefixes(input)
+			if err != nil {
+				return err
+			}
+			if err = loadTaxa(ctx, run, prefixes); err != nil {
+				return err
+			}
+		}
+		err = matchReducedInput(ctx, run, input)
+		util.Log(ctx).Info("Read queries", "stats", run.inputStats)
+		return err
+	}
+	byPrefix, err := accession.ReadQueries(ctx, input, format, &run.inputStats,
+		run.members, run.queryVersions)
+	if err != nil {
+		return util.Handle("Error in reading query accessions.", err)
+	}
+	util.Log(ctx).Info("Read queries", "stats", run.inputStats)
+	prefixes := accession.SortedPrefixes(byPrefix)
+	queryPrefixes := make(map[string]bool)
+	for _, prefix := range prefixes {
+		queryPrefixes[prefix] = true
+	}
+	if err = loadTaxa(ctx, run, queryPrefixes); err != nil {
+		return err
+	}
+	reduced := make(map[string][]string)
+	total := 0
+	for _, prefix := range prefixes {
+		reduced[prefix] = ranges.Reduce(byPrefix[prefix])
+		total += len(reduced[prefix])
+	}
+	run.prog = newProgress(ctx, "Sequence matching", "values", total, 0, nil)
+	defer run.prog.finish(ctx)
+	for _, prefix := range prefixes {
+		for _, valToFind := range reduced[prefix] {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			if err = findValue(ctx, run, prefix, valToFind); err != nil {
+				return err
+			}
+			run.prog.add(1, 0)
+		}
+	}
+	return err
+}
+
+// matchReducedInput goes line-by-line through a reduced input file of
+// "PREFIX: N" and "PREFIX: A-B" lines. Progress is the bytes read out of the
+// file size, so the input is only read once.
+func matchReducedInput(ctx context.Context, run *matchRun,
+	input string) error {
+	prog := newProgress(ctx, "Sequence matching", "lines", 0,
+		fileSize(input), nil)
+	run.prog = prog
+	defer prog.finish(ctx)
+	reader, closer, err := accession.OpenInputFunc(input, func(n int) {
+		prog.add(0, int64(n))
+	})
+	if err != nil {
+		return util.Handle("Error in opening input file.", err)
+	}
+	defer closer()
+	scanner := bufio.NewScanner(reader)
+
 	// Go line-by-line
 	for scanner.Scan() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
 		line := scanner.Text()
-		if !strings.Contains(line, ": ") || !strings.Contains(line, "_") {
+		run.inputStats.Lines++
+		run.prog.add(1, 0)
+		if strings.TrimSpace(line) == "" {
+			run.inputStats.Skipped++
+			continue
+		}
+		if !strings.Contains(line, ": ") {
+			run.inputStats.Unparseable++
 			continue
 		}
 		parts := strings.Split(line, ": ")
 		prefixToFind := parts[0]
-		if prefixToFind == "" {
+		if _, err = ranges.Parse(parts[1]); prefixToFind == "" || err != nil {
+			run.inputStats.Unparseable++
 			continue
 		}
-		valToFind := parts[1]
-		if !strings.Contains(valToFind, "-") {
-			// Dealing with a point value
-			findSingleValue(ctx, prefixToFind, valToFind)
-		} else {
-			// Dealing with a range
-			findRange(ctx, prefixToFind, valToFind)
+		run.inputStats.Accessions++
+		if err = findValue(ctx, run, prefixToFind, parts[1]); err != nil {
+			return err
 		}
 	}
+	if err = scanner.Err(); err != nil {
+		return util.Handle("Error in reading input file.", err)
+	}
 	return err
 }
 
+// findValue matches a point value or range for a prefix.
+func findValue(ctx context.Context, run *matchRun, prefix string,
+	valToFind string) error {
+	ctx = util.WithLog(ctx, "prefix", prefix)
+	if run.prog != nil {
+		if iv, err := ranges.Parse(valToFind); err == nil {
+			run.prog.addAccessions(iv.End - iv.Start + 1)
+		}
+	}
+	if !strings.Contains(valToFind, "-") {
+		// Dealing with a point value
+		return findSingleValue(ctx, run, prefix, valToFind)
+	}
+	// Dealing with a range
+	return findRange(ctx, run, prefix, valToFind)
+}
+
 // Matches a single accession number (prefix and number) to files in the
 // search directory.
-func findSingleValue(ctx *context, prefix string, toFind string) error {
+func findSingleValue(ctx context.Context, run *matchRun, prefix string,
+	toFind string) error {
 	num, err := strconv.Atoi(toFind)
 	if err != nil {
-		return handle("Error in converting to int.", err)
+		return util.Handle("Error in converting to int.", err)
 	}
-	res, err := accessionSearch(ctx, prefix, num)
-	if res != "" {
-		out := fmt.Sprintf("%s%-13d | %s", prefix, num, res)
-		writeLine(out, ctx.outFile)
+	res, err := run.searcher.Search(ctx, prefix, num)
+	if err != nil {
+		return util.Handle("Error in accession number search.", err)
+	}
+	tax := taxColumn(run, prefix, num)
+	member := ""
+	if len(res) == 0 {
+		member, res = memberSearch(ctx, run, prefix, num)
+	}
+	recordCoverage(run, prefix, 1, res)
+	if len(res) > 0 && member == "" {
+		for _, m := range res {
+			out := fmt.Sprintf("%s%-13d | %s%s", prefix, num, m, tax)
+			if err = writeLine(ctx, out, run.outFile); err != nil {
+				return err
+			}
+		}
+	} else if len(res) > 0 {
+		for _, m := range res {
+			out := fmt.Sprintf("%s%-13d | %s | via %s%s", prefix, num, m, member,
+				tax)
+			if err = writeLine(ctx, out, run.outFile); err != nil {
+				return err
+			}
+		}
+		run.viaMember++
 	} else {
-		out := fmt.Sprintf("%s%d not found.", prefix, num)
-		writeLine(out, ctx.outFile)
-		ctx.notFoundPrefixes[prefix] += 1 // Update not found counts
+		out := fmt.Sprintf("%s%d not found.%s", prefix, num, tax)
+		if err = writeLine(ctx, out, run.outFile); err != nil {
+			return err
+		}
+		run.notFoundPrefixes[prefix] += 1 // Update not found counts
+		metrics.NotFound.WithLabelValues("match").Inc()
+		run.notFound[prefix] = append(run.notFound[prefix], num)
+		if run.taxa != nil {
+			run.notFoundTaxa[run.taxa.Lookup(prefix, num)] += 1
+		}
 	}
 	return err
 }
 
+// memberSearch tries the other accessions in the same nr entry when an
+// accession isn't found. Returns the member that matched and its matches.
+func memberSearch(ctx context.Context, run *matchRun, prefix string,
+	num int) (string, []search.Match) {
+	for _, member := range run.members[accession.Key(prefix, num)] {
+		p, n, err := accession.Split(member)
+		if err != nil || p == "" {
+			continue
+		}
+		res, err := run.searcher.Search(ctx, p, n)
+		if err == nil && len(res) > 0 {
+			return member, res
+		}
+	}
+	return "", nil
+}
+
 // Matches an accession number range (e.g. XM_: 100-150) to files in the
 // search directory.
-func findRange(ctx *context, prefix string, toFind string) error {
+func findRange(ctx context.Context, run *matchRun, prefix string,
+	toFind string) error {
 	p := strings.Split(toFind, "-")
-	startNum, startRes, err := rangePiece(ctx, prefix, p[0])
+	startNum, startRes, err := rangePiece(ctx, run, prefix, p[0])
 	if err != nil {
-		return handle("Error in finding results for range start.", err)
+		return util.Handle("Error in finding results for range start.", err)
 	}
-	endNum, endRes, err := rangePiece(ctx, prefix, p[1])
+	endNum, endRes, err := rangePiece(ctx, run, prefix, p[1])
 	if err != nil {
-		return handle("Error in finding results for range end.", err)
+		return util.Handle("Error in finding results for range end.", err)
 	}
 
-	if strings.Contains(startRes, "-") && startRes == endRes {
-		// Result was a range, and the start/end numbers matched to the same range.
-		// This means that all the intermediate range values must also be included
-		// in the result.
-		out := fmt.Sprintf("%s%-13s | %s", prefix, toFind, startRes)
-		writeLine(out, ctx.outFile)
+	if sameRanges(startRes, endRes) {
+		// Results were ranges, and the start/end numbers matched to the same
+		// ranges. This means that all the intermediate range values must also be
+		// included in the result.
+		tax := rangeTaxColumn(run, prefix, startNum, endNum)
+		recordCoverage(run, prefix, endNum-startNum+1, startRes)
+		for _, m := range startRes {
+			out := fmt.Sprintf("%s%-13s | %s%s", prefix, toFind, m, tax)
+			if err = writeLine(ctx, out, run.outFile); err != nil {
+				return err
+			}
+		}
 	} else {
 		// Otherwise just go through the range sequentially and check each point
 		// value.
 		for i := startNum; i <= endNum; i++ {
-			if err = findSingleValue(ctx, prefix, strconv.Itoa(i)); err != nil {
-				return handle("Error in searching for point value.", err)
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			err = findSingleValue(ctx, run, prefix, strconv.Itoa(i))
+			if err != nil {
+				return util.Handle("Error in searching for point value.", err)
 			}
 		}
 	}
 	return err
 }
 
-// Writes a line to stdout and the results file.
-func writeLine(input string, outFile *os.File) error {
-	fmt.Println(input)
-	if _, err := outFile.WriteString(input + "\n"); err != nil {
-		return handle("Error in writing line.", err)
-	}
-	return nil
-}
-
-// A prefixResult represents the matches from searching for a prefix.
-// - accessionNums is a list of the number values/ranges found with the same
-// prefix.
-// - valueToFile is a mapping of values/ranges to the file name in which the
-// match was found.
-type prefixResult struct {
-	accessionNums []string
-	valueToFile   map[string]string
-}
-
-// Gets the results of a search for a prefix to all the matching accession
-// numbers in the search directory.
-func prefixToResults(ctx *context, prefix string) (prefixResult, error) {
-	// Setup
-	var err error
-	accessionNums := []string{}
-	valueToFile := make(map[string]string)
-
-	res, present := ctx.prefixCache[prefix]
-	if present {
-		return res, err
-	}
-
-	// Get results from disk by calling sift.
-	dest := ctx.searchDirA
-	if strings.Contains(prefix, "_") {
-		// Underscore is only for the Refseq files
-		dest = ctx.searchDirB
-	}
-	template := "sift '%s' '%s' -w --binary-skip | sort -k2 -n"
-	cmd := fmt.Sprintf(template, prefix, dest)
-	stdout, _, err := commandVerboseOnErr(cmd)
-	if err != nil {
-		return res, handle("Error in calling search utility", err)
-	}
-
-	// Process output
-	lines := strings.Split(stdout, "\n")
-	if len(lines) == 0 { // No results. Return with empty values.
-		return res, err
+// sameRanges checks if the start and end of a query range matched the same
+// range values in the same locations.
+func sameRanges(start []search.Match, end []search.Match) bool {
+	if len(start) == 0 || len(start) != len(end) {
+		return false
 	}
-
-	// Make mapping of accession num/ranges to filename.
-	// Make an ascending array of the accession num/ranges.
-	for _, line := range lines {
-		if strings.Contains(line, ": ") {
-			pieces := strings.Split(line, ": ")
-			key := pieces[1]
-			accessionNums = append(accessionNums, key)
-			// Format the file names:lines
-			snip := pieces[0][len(ctx.searchDirA):]
-			snip = snip[:len(snip)-len(prefix)-1]
-			valueToFile[key] = snip
+	for i := range start {
+		if !strings.Contains(start[i].Found, "-") || start[i] != end[i] {
+			return false
 		}
 	}
-
-	// Add to cache
-	res = prefixResult{accessionNums, valueToFile}
-	ctx.prefixCache[prefix] = res
-
-	return res, err
-}
-
-// accessionSearch matches a single prefix and target num to matches in the
-// search directory.
-func accessionSearch(ctx *context, prefix string, targetNum int) (string,
-	error) {
-	// Setup
-	var err error
-	accessionNums := []string{}
-	valueToFile := make(map[string]string)
-
-	// Get prefix to file search results
-	if prefix != ctx.curPrefix {
-		// Clear the cache when the prefix changes due to memory issues.
-		ctx.curPrefix = prefix
-		ctx.prefixCache = make(map[string]prefixResult)
-	}
-	prefixRes, err := prefixToResults(ctx, prefix)
-	if err != nil {
-		return "", handle("Error in getting file results for the prefix", err)
-	}
-	accessionNums = prefixRes.accessionNums
-	valueToFile = prefixRes.valueToFile
-
-	// Call the binary search of the results
-	res, err := arraySearch(accessionNums, targetNum)
-	if err != nil {
-		return "", handle("Error in searching array", err)
-	}
-
-	// Format results
-	if res > 0 && res < len(accessionNums) {
-		matched := accessionNums[res]
-		resFile := valueToFile[matched]
-		resFile = resFile[:len(resFile)-4]
-		out := fmt.Sprintf("%-13s | %s", accessionNums[res], resFile)
-		return out, err
-	}
-	return "", err
+	return true
 }
 
-// Modified binary search on the array where toFind is a point value and
-// toSearch contains either point values or ranges.
-func arraySearch(toSearch []string, toFind int) (int, error) {
-	n := len(toSearch)
-	low, high := 0, n-1
-	for low <= high {
-		mid := low + (high-low)/2 // Midpoint
-		lookAt := toSearch[mid]
-
-		if !strings.Contains(lookAt, "-") {
-			// Point val in array. Standard binary search iterations.
-			lookAtVal, err := strconv.Atoi(lookAt)
-			if err != nil {
-				return 0, handle("Problem converting number", err)
-			}
-			if lookAtVal > toFind {
-				high = mid - 1
-			} else if lookAtVal < toFind {
-				low = mid + 1
-			} else { // Found
-				return mid, err
-			}
-		} else {
-			// Range val in array
-			p := strings.Split(lookAt, "-")
-			bottom, err := strconv.Atoi(p[0]) // Lower bound
-			if err != nil {
-				return 0, handle("Problem converting number", err)
-			}
-			top, err := strconv.Atoi(p[1]) // Upper bound
-			if err != nil {
-				return 0, handle("Problem converting number", err)
-			}
-			if bottom <= toFind && toFind <= top {
-				return mid, err // Found in current range
-			} else if toFind < bottom {
-				high = mid - 1
-			} else if top < toFind {
-				low = mid + 1
-			}
-		}
+// Writes a line to the results file. Also logged at debug level.
+func writeLine(ctx context.Context, input string, outFile *os.File) error {
+	util.Log(ctx).Debug("Result", "line", input)
+	if _, err := outFile.WriteString(input + "\n"); err != nil {
+		return util.Handle("Error in writing line.", err)
 	}
-	return -1, nil // Not found.
+	return nil
 }
 
 // rangePiece gets the single value accession number search results for a
 // piece of a range.
-func rangePiece(ctx *context, prefix string, input string) (int, string,
-	error) {
+func rangePiece(ctx context.Context, run *matchRun, prefix string,
+	input string) (int, []search.Match, error) {
 	num, err := strconv.Atoi(input)
 	if err != nil {
-		return 0, "", handle("Error in converting to int.", err)
+		return 0, nil, util.Handle("Error in converting to int.", err)
 	}
-	res, err := accessionSearch(ctx, prefix, num)
+	res, err := run.searcher.Search(ctx, prefix, num)
 	if err != nil {
-		return 0, "", handle("Error in accession number search.", err)
+		return 0, nil, util.Handle("Error in accession number search.", err)
 	}
 	return num, res, err
 }
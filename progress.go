@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// How often progress is logged when stderr isn't a terminal.
+var progressEvery = flag.Duration("progress-every", time.Minute,
+	"How often to log progress when not on a terminal")
+
+// How often the progress line is redrawn on a terminal.
+const progressRedraw = time.Second
+
+// A statusWriter writes logs to a terminal below a status line that stays
+// at the bottom (e.g. a progress line). Safe for concurrent use.
+type statusWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	status string // Current status line. Empty for none
+}
+
+// newStatusWriter wraps the writer for the logs (usually stderr).
+func newStatusWriter(out io.Writer) *statusWriter {
+	return &statusWriter{out: out}
+}
+
+// Write clears the status line, writes p, and redraws the status line.
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.status == "" {
+		return w.out.Write(p)
+	}
+	fmt.Fprint(w.out, "\r\033[K")
+	n, err := w.out.Write(p)
+	fmt.Fprint(w.out, w.status)
+	return n, err
+}
+
+// setStatus replaces the status line. Empty clears it.
+func (w *statusWriter) setStatus(status string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprint(w.out, "\r\033[K"+status)
+	w.status = status
+}
+
+// The log writer, set up in main. Progress lines are drawn on it if it's a
+// terminal.
+var logOut = newStatusWriter(os.Stderr)
+
+// isTerminal checks if f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// A progress reports how far along a long run is: items (e.g. files) and
+// bytes done out of the totals, accessions per second, and an ETA. On a
+// terminal it's a status line kept below the logs. Otherwise it's logged
+// every -progress-every. Safe for concurrent use.
+type progress struct {
+	mu         sync.Mutex
+	name       string
+	unit       string         // Name of the items. E.g. "files"
+	totalItems int            // Items to do. 0 if unknown
+	totalBytes int64          // Bytes to do. 0 if unknown
+	items      int            // Items done
+	bytes      int64          // Bytes done
+	accessions float64        // Accessions done, if counted with add
+	countAcc   func() float64 // Gives the accessions done, if set
+	start      time.Time
+	stop       chan struct{}
+	stopped    chan struct{}
+}
+
+// newProgress starts reporting the progress of a run until ctx is done or
+// finish is called. countAcc gives the accessions processed so far, if they
+// aren't counted with addAccessions (e.g. from a metrics counter).
+func newProgress(ctx context.Context, name string, unit string,
+	totalItems int, totalBytes int64, countAcc func() float64) *progress {
+	p := &progress{name: name, unit: unit, totalItems: totalItems,
+		totalBytes: totalBytes, countAcc: countAcc, start: time.Now(),
+		stop: make(chan struct{}), stopped: make(chan struct{})}
+	base := 0.0
+	if countAcc != nil {
+		base = countAcc() // Only count from the start of the run.
+		p.countAcc = func() float64 { return countAcc() - base }
+	}
+	go p.run(ctx)
+	return p
+}
+
+// add records items and bytes done.
+func (p *progress) add(items int, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.items += items
+	p.bytes += bytes
+}
+
+// addAccessions records accessions done.
+func (p *progress) addAccessions(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.accessions += float64(n)
+}
+
+// finish stops reporting and logs the final progress.
+func (p *progress) finish(ctx context.Context) {
+	close(p.stop)
+	<-p.stopped
+	p.log(ctx, "Done")
+}
+
+// Reports until stopped. Redraws the status line on a terminal (unless logs
+// are JSON for a collector, or quiet), otherwise logs periodically.
+func (p *progress) run(ctx context.Context) {
+	defer close(p.stopped)
+	bar := isTerminal(os.Stderr) && *logFormat == "text" && !*quiet
+	every := *progressEvery
+	if bar {
+		every = progressRedraw
+		defer logOut.setStatus("")
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if bar {
+			logOut.setStatus(p.String())
+		} else {
+			p.log(ctx, "Progress")
+		}
+	}
+}
+
+// A progressSnapshot is the progress at a point in time with its rates.
+type progressSnapshot struct {
+	items, totalItems int
+	bytes, totalBytes int64
+	accPerSec         float64
+	elapsed, eta      time.Duration // eta is -1 if unknown
+}
+
+// snapshot gets the current progress. The ETA is from the bytes if the
+// total is known, otherwise from the items.
+func (p *progress) snapshot() progressSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := progressSnapshot{items: p.items, totalItems: p.totalItems,
+		bytes: p.bytes, totalBytes: p.totalBytes,
+		elapsed: time.Since(p.start), eta: -1}
+	acc := p.accessions
+	if p.countAcc != nil {
+		acc = p.countAcc()
+	}
+	secs := s.elapsed.Seconds()
+	if secs > 0 {
+		s.accPerSec = acc / secs
+	}
+	done, total := float64(p.items), float64(p.totalItems)
+	if p.totalBytes > 0 {
+		done, total = float64(p.bytes), float64(p.totalBytes)
+	}
+	if done > 0 && total >= done {
+		s.eta = time.Duration(secs * (total - done) / done * float64(time.Second))
+	}
+	return s
+}
+
+// String formats the progress for the status line. E.g.
+// Extraction: 12/300 files (4.0%), 1.2/40.0 GB, 3500 acc/s, ETA 2h13m0s
+func (p *progress) String() string {
+	s := p.snapshot()
+	res := fmt.Sprintf("%s: %d %s", p.name, s.items, p.unit)
+	if s.totalItems > 0 {
+		res = fmt.Sprintf("%s: %d/%d %s (%.1f%%)", p.name, s.items,
+			s.totalItems, p.unit, 100*float64(s.items)/float64(s.totalItems))
+	}
+	if s.totalBytes > 0 {
+		res += fmt.Sprintf(", %.1f/%.1f GB", float64(s.bytes)/1e9,
+			float64(s.totalBytes)/1e9)
+	}
+	res += fmt.Sprintf(", %.0f acc/s", s.accPerSec)
+	if s.eta >= 0 {
+		res += ", ETA " + s.eta.Round(time.Second).String()
+	}
+	return res
+}
+
+// log logs the progress with its fields.
+func (p *progress) log(ctx context.Context, msg string) {
+	s := p.snapshot()
+	args := []interface{}{"run", p.name, p.unit, s.items, "total", s.totalItems,
+		"acc_per_sec", int(s.accPerSec),
+		"elapsed", s.elapsed.Round(time.Second).String()}
+	if s.totalBytes > 0 {
+		args = append(args, "bytes", s.bytes, "total_bytes", s.totalBytes)
+	}
+	if s.eta >= 0 && msg != "Done" {
+		args = append(args, "eta", s.eta.Round(time.Second).String())
+	}
+	util.Log(ctx).Info(msg, args...)
+}
@@ -2,194 +2,184 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/ranges"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
 )
 
 // Takes in a directory and creates copies of the files with point values
-// reduced into ranges. E.g. AC1, AC2, AC3 -> AC: 1-3.
-func rangeReduction() error {
-	home := getUserHome()
+// reduced into ranges. E.g. AC1, AC2, AC3 -> AC: 1-3. Only plans the copies
+// in a dry run.
+func rangeReduction(ctx context.Context) error {
+	home := util.UserHome()
 	dir := home + "/sequence_lists/genbank"
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
-		return handle("Error in range reduction", err)
+		return util.Handle("Error in range reduction", err)
 	}
 	for _, f := range files {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
 		folder := home + "/sequence_lists/genbank_reduced"
+		if util.DryRun(ctx) {
+			util.PlannedOutput(ctx, folder+"/"+f.Name(), f.Size())
+			continue
+		}
 		if err = os.MkdirAll(folder, os.ModePerm); err != nil {
-			return handle("Error in making results folder", err)
+			return util.Handle("Error in making results folder", err)
 		}
 		outFile, err := os.Create(folder + "/" + f.Name())
 		if err != nil {
-			return handle("Error in making out file", err)
+			return util.Handle("Error in making out file", err)
+		}
+		if err = reduceOneFile(ctx, dir+"/"+f.Name(), outFile); err != nil {
+			return util.Handle("Error in reducing "+f.Name(), err)
 		}
-		processFile(dir+"/"+f.Name(), outFile)
 	}
 	return err
 }
 
 // Runs the range reduction process on a single file. E.g. AC1, AC2, AC3 ->
-// AC: 1-3.
-func rangeReductionSingle() error {
-	home := getUserHome()
+// AC: 1-3. Only plans the output in a dry run.
+func rangeReductionSingle(ctx context.Context) error {
+	home := util.UserHome()
 	folder := home + "/sequence_lists/blast/db/FASTA/"
 	fname := "nr.gz.trimmed.sorted.txt"
-	outFile, err := os.Create(folder + "nr.gz.trimmed.sorted.reduced.txt")
+	output := folder + "nr.gz.trimmed.sorted.reduced.txt"
+	if util.DryRun(ctx) {
+		util.PlannedOutput(ctx, output, fileSize(folder+fname))
+		return nil
+	}
+	outFile, err := os.Create(output)
 	if err != nil {
-		return handle("Error in creating out file", err)
+		return util.Handle("Error in creating out file", err)
+	}
+	if err = reduceOneFile(ctx, folder+fname, outFile); err != nil {
+		return util.Handle("Error in reducing "+fname, err)
 	}
-	processFile(folder+fname, outFile)
 	return err
 }
 
 // Trims version numbers from lines of accession number sequences from a
 // whole directory.
-func trimWholeDir() {
-	dir := getUserHome() + "/sequence_lists/refseq"
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+func trimWholeDir(ctx context.Context) error {
+	dir := util.UserHome() + "/sequence_lists/refseq"
+	return filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+		if err != nil {
+			return util.Handle("Error in walking "+path, err)
+		}
 		if info.IsDir() || string(filepath.Base(path)[0]) == "." {
 			return nil
 		}
-		if err = formatOneFile(path); err != nil {
-			return handle("Error in formatting file: "+path, err)
+		if err = formatOneFile(ctx, path); err != nil {
+			return util.Handle("Error in formatting file: "+path, err)
 		}
 		return nil
 	})
 }
 
 // Trims version numbers and formats lines of accession numbers in a single
-// file. Doesn't reduce ranges. Only formats existing point value lines.
-func formatOneFile(input string) error {
+// file. Doesn't reduce ranges. Only formats existing point value lines. Only
+// plans the output in a dry run.
+func formatOneFile(ctx context.Context, input string) error {
 	// Setup
-	trimFolder := getUserHome() + "/sequence_lists/refseq_trimmed"
+	home := util.UserHome()
+	trimFolder := home + "/sequence_lists/refseq_trimmed"
 	dirSnip := filepath.Dir(input)
-	dirSnip = dirSnip[len("/Users/jsheu/sequence_lists/refseq"):]
+	dirSnip = dirSnip[len(home+"/sequence_lists/refseq"):]
 	folder := trimFolder + dirSnip
-	if err := os.MkdirAll(folder, os.ModePerm); err != nil {
-		return handle("Error in making out folder", err)
-	}
 	name := filepath.Base(input)
 	name = name[:len(name)-4]
-	outFile, err := os.Create(folder + "/" + name + ".trimmed.txt")
-	if err != nil {
-		return handle("Error in creating out file", err)
-	}
-
-	var prefix string
-	var number int
-	// Open the file
-	file, err := os.Open(input)
-	if err != nil {
-		return handle("Error in opening file: "+input, err)
-	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	// Go line by line
-	for scanner.Scan() {
-		line := scanner.Text()
-		prefix, number, err = splitLine(line)
-		if err != nil {
-			continue
-		}
-		out := fmt.Sprintf("%s: %d\n", prefix, number)
-		outFile.WriteString(out)
-		fmt.Print(out)
+	output := folder + "/" + name + ".trimmed.txt"
+	if util.DryRun(ctx) {
+		util.PlannedOutput(ctx, output, fileSize(input))
+		return nil
 	}
-	if err = scanner.Err(); err != nil {
-		return handle("Error in reading lines from file", err)
+	if err := os.MkdirAll(folder, os.ModePerm); err != nil {
+		return util.Handle("Error in making out folder", err)
 	}
-	return err
+	return trimFile(ctx, input, output)
 }
 
-// processFile takes a file and creates a copy with reduced and formatted
-// ranges. E.g. AC1, AC2, AC3 -> AC: 1-3.
-func processFile(pathName string, outFile *os.File) error {
-	fmt.Println("File: " + pathName)
-	var prefix, curPrefix string
-	var curNumber, rangeStart, number int
+// Size of a file for estimating outputs. -1 if unknown.
+func fileSize(path string) int64 {
+	if info, err := os.Stat(path); err == nil {
+		return info.Size()
+	}
+	return -1
+}
 
+// trimFile writes the accession numbers of a file without their versions to
+// output, formatted as point values. E.g. AC1.2 -> AC: 1. The output is
+// removed if reading, writing, or closing fails or ctx is cancelled.
+func trimFile(ctx context.Context, input string, output string) error {
 	// Open the file
-	file, err := os.Open(pathName)
+	file, err := os.Open(input)
 	if err != nil {
-		return handle("Error in processing single file", err)
+		return util.Handle("Error in opening file: "+input, err)
 	}
 	defer file.Close()
+	outFile, err := os.Create(output)
+	if err != nil {
+		return util.Handle("Error in creating out file", err)
+	}
+	defer outFile.Close() // Closed already unless there's an error
+	out := bufio.NewWriter(outFile)
+
 	scanner := bufio.NewScanner(file)
 	// Go line by line
-	for scanner.Scan() {
-		line := scanner.Text()
-		prefix, number, err = splitLine(line)
-		if err != nil {
-			continue
+	for scanner.Scan() && err == nil {
+		if err = ctx.Err(); err != nil {
+			break
 		}
-		if curPrefix == "" && curNumber == 0 {
-			// First prefix and number
-			curPrefix = prefix
-			curNumber = number
-			rangeStart = number
+		prefix, number, splitErr := accession.Split(scanner.Text())
+		if splitErr != nil {
 			continue
 		}
-		if prefix == curPrefix && number == (curNumber+1) {
-			// Continued sequence. Incrementing curNumber.
-			curNumber = number
-		} else {
-			// Sequence broken. Write out the point value or range.
-			if rangeStart == curNumber {
-				outFile.WriteString(fmt.Sprintf("%s: %d\n", prefix, rangeStart))
-			} else {
-				outFile.WriteString(fmt.Sprintf("%s: %d-%d\n", prefix, rangeStart,
-					curNumber))
-			}
-			// Update
-			curPrefix = prefix
-			curNumber = number
-			rangeStart = number
-		}
+		_, err = fmt.Fprintf(out, "%s: %d\n", prefix, number)
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+	if err == nil {
+		err = out.Flush()
 	}
-	// Last write out
-	if rangeStart == curNumber {
-		outFile.WriteString(fmt.Sprintf("%s: %d\n", prefix, rangeStart))
-	} else {
-		outFile.WriteString(fmt.Sprintf("%s: %d-%d\n", prefix, rangeStart,
-			curNumber))
+	if err == nil {
+		err = outFile.Close()
 	}
-	if err = scanner.Err(); err != nil {
-		return handle("Error in reading lines from file", err)
+	if err != nil {
+		os.Remove(output)
+		return util.Handle("Error in trimming file: "+input, err)
 	}
 	return err
 }
 
-// Splits the line into the prefix and the numerical value. Could probably
-// replace with some RegEx...
-func splitLine(line string) (string, int, error) {
-	var number int
-	var err error
-	for i, char := range line {
-		if _, err := strconv.Atoi(string(char)); err != nil {
-			continue // Skip if not a number
-		}
-		if i == 0 { // Beginning of the line
-			number, err = strconv.Atoi(string(line))
-			if err != nil {
-				return "", 0, err
-			}
-			return "", number, err
-		}
-		prefix := line[:i]
-		numStr := line[i:]
-		if strings.Contains(numStr, ".") {
-			parts := strings.Split(numStr, ".")
-			numStr = parts[0]
-		}
-		if number, err = strconv.Atoi(numStr); err != nil {
-			return "", 0, err
-		}
-		return prefix, number, err
+// reduceOneFile creates a copy of a file with reduced and formatted ranges.
+// E.g. AC1, AC2, AC3 -> AC: 1-3. Closes outFile. The copy is removed if
+// reducing, writing, or closing fails or ctx is cancelled.
+func reduceOneFile(ctx context.Context, pathName string,
+	outFile *os.File) error {
+	defer outFile.Close() // Closed already unless there's an error
+	util.Log(ctx).Info("Reducing", "file", pathName)
+	out := bufio.NewWriter(outFile)
+	err := ranges.ReduceFile(ctx, pathName, out)
+	if err == nil {
+		err = out.Flush()
+	}
+	if err == nil {
+		err = outFile.Close()
 	}
-	return "", 0, err
+	if err != nil {
+		os.Remove(outFile.Name())
+		return util.Handle("Error in reducing file", err)
+	}
+	return err
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrimFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "accs.txt")
+	err := ioutil.WriteFile(input, []byte("NM_1.2\nXP_30.1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "accs.trimmed.txt")
+	if err = trimFile(context.Background(), input, output); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(output)
+	if want := "NM_: 1\nXP_: 30\n"; err != nil || string(got) != want {
+		t.Errorf("Got %q, %v. Want %q", got, err, want)
+	}
+
+	// Cancelled runs leave no partial output.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = trimFile(ctx, input, output); err == nil {
+		t.Error("Want an error when cancelled")
+	}
+	if _, err = os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("Left a partial %s", output)
+	}
+}
@@ -0,0 +1,97 @@
+// Package ranges has the point value and range codec used by the reduced
+// accession files. E.g. AC1, AC2, AC3 -> AC: 1-3. Intervals parsed from the
+// files can be searched for the ones containing a number or overlapping a
+// range.
+package ranges
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An Interval is a point value (start == end) or range of accession numbers
+// found for a prefix, along with the files it was found in.
+type Interval struct {
+	Start int
+	End   int
+	Files []string
+}
+
+// String formats an interval the same way as the reduced files. E.g. 100 or
+// 100-150.
+func (iv Interval) String() string {
+	if iv.Start == iv.End {
+		return strconv.Itoa(iv.Start)
+	}
+	return fmt.Sprintf("%d-%d", iv.Start, iv.End)
+}
+
+// Contains checks if a number falls in the interval.
+func (iv Interval) Contains(num int) bool {
+	return iv.Start <= num && num <= iv.End
+}
+
+// Parse parses a point value or range string. E.g. 100 or 100-150.
+func Parse(value string) (Interval, error) {
+	p := strings.Split(value, "-")
+	start, err := strconv.Atoi(p[0])
+	if err != nil {
+		return Interval{}, err
+	}
+	end := start
+	if len(p) > 1 {
+		if end, err = strconv.Atoi(p[1]); err != nil {
+			return Interval{}, err
+		}
+	}
+	return Interval{Start: start, End: end}, err
+}
+
+// Sort orders the intervals by start, then end, and fills in the
+// running max of the ends used for finding overlapping intervals.
+func Sort(intervals []Interval) []int {
+	sort.Slice(intervals, func(i, j int) bool {
+		if intervals[i].Start != intervals[j].Start {
+			return intervals[i].Start < intervals[j].Start
+		}
+		return intervals[i].End < intervals[j].End
+	})
+	maxEnd := make([]int, len(intervals))
+	for i, iv := range intervals {
+		maxEnd[i] = iv.End
+		if i > 0 && maxEnd[i-1] > iv.End {
+			maxEnd[i] = maxEnd[i-1]
+		}
+	}
+	return maxEnd
+}
+
+// Search returns the indexes of all the intervals containing num.
+// intervals must be sorted with maxEnd from Sort.
+func Search(intervals []Interval, maxEnd []int, num int) []int {
+	return SearchOverlaps(intervals, maxEnd, num, num)
+}
+
+// SearchOverlaps returns the indexes of all the intervals overlapping low to
+// high. Binary searches for the last interval starting at or before high,
+// then walks back while earlier intervals could still reach low. For a single
+// number that's usually just one interval.
+func SearchOverlaps(intervals []Interval, maxEnd []int, low int,
+	high int) []int {
+	res := []int{}
+	i := sort.Search(len(intervals), func(i int) bool {
+		return intervals[i].Start > high
+	}) - 1
+	for ; i >= 0 && maxEnd[i] >= low; i-- {
+		if intervals[i].End >= low {
+			res = append(res, i)
+		}
+	}
+	// Put back in ascending order
+	for l, r := 0, len(res)-1; l < r; l, r = l+1, r-1 {
+		res[l], res[r] = res[r], res[l]
+	}
+	return res
+}
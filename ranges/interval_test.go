@@ -0,0 +1,132 @@
+package ranges
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Interval
+		ok    bool
+	}{
+		{"100", Interval{Start: 100, End: 100}, true},
+		{"100-150", Interval{Start: 100, End: 150}, true},
+		{"x", Interval{}, false},
+		{"1-x", Interval{}, false},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %v, %v. Want %v, ok %v", tt.value, got, err,
+				tt.want, tt.ok)
+		}
+		if err == nil && got.String() != tt.value {
+			t.Errorf("Parse(%q).String() = %q", tt.value, got.String())
+		}
+	}
+}
+
+func TestSearchOverlaps(t *testing.T) {
+	intervals := []Interval{{Start: 50, End: 60}, {Start: 1, End: 100},
+		{Start: 5, End: 5}, {Start: 200, End: 300}, {Start: 90, End: 210}}
+	maxEnd := Sort(intervals)
+	// Sorted: 1-100, 5, 50-60, 90-210, 200-300
+	tests := []struct {
+		low, high int
+		want      []string
+	}{
+		{5, 5, []string{"1-100", "5"}},
+		{55, 55, []string{"1-100", "50-60"}},
+		{101, 150, []string{"90-210"}},
+		{205, 205, []string{"90-210", "200-300"}},
+		{0, 0, []string{}},
+		{301, 400, []string{}},
+		{0, 1000, []string{"1-100", "5", "50-60", "90-210", "200-300"}},
+	}
+	for _, tt := range tests {
+		got := []string{}
+		for _, i := range SearchOverlaps(intervals, maxEnd, tt.low, tt.high) {
+			got = append(got, intervals[i].String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchOverlaps(%d, %d) = %v. Want %v", tt.low, tt.high,
+				got, tt.want)
+		}
+	}
+}
+
+func TestReduce(t *testing.T) {
+	tests := []struct {
+		nums []int
+		want []string
+	}{
+		{[]int{3, 1, 2, 7}, []string{"1-3", "7"}},
+		{[]int{5, 5, 6}, []string{"5-6"}},
+		{[]int{10, 2}, []string{"2", "10"}},
+		{nil, []string{}},
+	}
+	for _, tt := range tests {
+		if got := Reduce(tt.nums); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Reduce(%v) = %v. Want %v", tt.nums, got, tt.want)
+		}
+	}
+}
+
+func TestRangeWriter(t *testing.T) {
+	var out strings.Builder
+	w := NewRangeWriter(&out)
+	for _, acc := range []struct {
+		prefix string
+		num    int
+	}{{"AC", 1}, {"AC", 2}, {"AC", 3}, {"AC", 7}, {"XP_", 8}, {"XP_", 9}} {
+		if err := w.Add(acc.prefix, acc.num); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "AC: 1-3\nAC: 7\nXP_: 8-9\n"
+	if out.String() != want {
+		t.Errorf("RangeWriter wrote %q. Want %q", out.String(), want)
+	}
+}
+
+// Point and range lookups over a million intervals. Ranges and gaps are
+// random so some queries miss.
+func BenchmarkSearchOverlaps(b *testing.B) {
+	n := 1000000
+	rnd := rand.New(rand.NewSource(1))
+	intervals := make([]Interval, 0, n)
+	cur := 1
+	for i := 0; i < n; i++ {
+		cur += rnd.Intn(10) // Gap
+		end := cur
+		if rnd.Intn(2) == 0 {
+			end += rnd.Intn(100) // Range
+		}
+		intervals = append(intervals, Interval{Start: cur, End: end,
+			Files: []string{"file.txt"}})
+		cur = end + 1
+	}
+	rnd.Shuffle(len(intervals), func(i, j int) {
+		intervals[i], intervals[j] = intervals[j], intervals[i]
+	})
+	maxEnd := Sort(intervals)
+
+	b.Run("point", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Search(intervals, maxEnd, rnd.Intn(cur))
+		}
+	})
+	b.Run("range", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			low := rnd.Intn(cur)
+			SearchOverlaps(intervals, maxEnd, low, low+rnd.Intn(50))
+		}
+	})
+}
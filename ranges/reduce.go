@@ -0,0 +1,127 @@
+package ranges
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// A RangeWriter reduces a stream of sorted accession numbers into point
+// values and ranges, and writes them as lines of the reduced files. E.g. AC1,
+// AC2, AC3 -> AC: 1-3.
+type RangeWriter struct {
+	out     io.Writer
+	prefix  string // Prefix of the current run
+	start   int    // First number of the current run
+	end     int    // Last number of the current run
+	started bool   // If there is a current run
+}
+
+// NewRangeWriter makes a RangeWriter writing to out.
+func NewRangeWriter(out io.Writer) *RangeWriter {
+	return &RangeWriter{out: out}
+}
+
+// Add adds the next accession number. Consecutive numbers with the same
+// prefix are joined into a range. Otherwise the current run is written out.
+func (w *RangeWriter) Add(prefix string, number int) error {
+	if w.started && prefix == w.prefix && number == w.end+1 {
+		w.end = number // Continued sequence
+		return nil
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.prefix, w.start, w.end, w.started = prefix, number, number, true
+	return nil
+}
+
+// Flush writes out the current run as a point value or range.
+func (w *RangeWriter) Flush() error {
+	if !w.started {
+		return nil
+	}
+	w.started = false
+	iv := Interval{Start: w.start, End: w.end}
+	_, err := fmt.Fprintf(w.out, "%s: %s\n", w.prefix, iv)
+	return err
+}
+
+// ReduceFile reads a sorted file of accessions, one per line, and writes the
+// reduced point values and ranges to out. Lines can also be trimmed point
+// values like AC: 1, sorted by prefix and then number. Lines without an
+// accession are skipped. Stops if ctx is cancelled.
+func ReduceFile(ctx context.Context, path string, out io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return util.Handle("Error in processing single file", err)
+	}
+	defer file.Close()
+	w := NewRangeWriter(out)
+	scanner := bufio.NewScanner(file)
+	// Go line by line
+	for scanner.Scan() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		prefix, number, err := splitPoint(scanner.Text())
+		if err != nil {
+			continue
+		}
+		if err = w.Add(prefix, number); err != nil {
+			return util.Handle("Error in writing ranges", err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return util.Handle("Error in reading lines from file", err)
+	}
+	// Last write out
+	if err = w.Flush(); err != nil {
+		return util.Handle("Error in writing ranges", err)
+	}
+	return err
+}
+
+// Splits a line into its prefix and number. The line is an accession like
+// AC1.2 or a point value like AC: 1.
+func splitPoint(line string) (string, int, error) {
+	prefix, value, found := strings.Cut(line, ": ")
+	if !found {
+		return accession.Split(line)
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return "", 0, &util.ParseError{Text: line, Err: err}
+	}
+	return prefix, number, err
+}
+
+// Reduce sorts and de-duplicates a list of numbers and reduces them into
+// point values and ranges in the same form as RangeWriter. E.g. 3, 1, 2, 7 ->
+// 1-3, 7.
+func Reduce(nums []int) []string {
+	res := []string{}
+	if len(nums) == 0 {
+		return res
+	}
+	sort.Ints(nums)
+	rangeStart, curNumber := nums[0], nums[0]
+	for _, number := range nums[1:] {
+		if number == curNumber || number == curNumber+1 {
+			curNumber = number // Duplicate or continued sequence
+			continue
+		}
+		res = append(res, Interval{Start: rangeStart, End: curNumber}.String())
+		rangeStart, curNumber = number, number
+	}
+	res = append(res, Interval{Start: rangeStart, End: curNumber}.String())
+	return res
+}
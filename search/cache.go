@@ -0,0 +1,238 @@
+package search
+
+import (
+	"container/list"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/ranges"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// prefixCache is a least-recently-used cache of prefix search results with
+// a rough memory budget. Results evicted from memory can optionally be
+// spilled to disk so that unsorted or interleaved inputs don't have to re-run
+// the search utility for prefixes seen before. Safe for concurrent use.
+type prefixCache struct {
+	mu        sync.Mutex
+	budget    int64                    // Max estimated bytes held in memory
+	size      int64                    // Current estimated bytes held
+	items     map[string]*list.Element // Key to entry in order
+	order     *list.List               // Front is the most recently used
+	spillDir  string                   // Where evicted results go, if set
+	spillGen  int64                    // Marks this cache's spill files
+	hits      int                      // Found in memory
+	spillHits int                      // Found on disk
+	misses    int                      // Not found at all
+	evictions int                      // Removed from memory
+}
+
+// A cacheEntry is a single cached prefix result with its estimated size.
+type cacheEntry struct {
+	key  string
+	res  Result
+	size int64
+}
+
+// spilledResult is the on-disk form of a Result. Fields are exported
+// for gob.
+type spilledResult struct {
+	Starts []int
+	Ends   []int
+	Files  [][]string
+}
+
+// spillCleared has the spill dirs already cleared by this process.
+var spillCleared = struct {
+	sync.Mutex
+	dirs map[string]bool
+}{dirs: make(map[string]bool)}
+
+// newPrefixCache makes a cache holding roughly budget bytes of results. An
+// empty spillDir disables spilling to disk. Spill files left by earlier runs
+// are removed the first time a dir is used since the collections may have
+// changed since. Each cache also names its files with its own generation, so
+// a cache still serving during a reload never shares results with the new
+// one.
+func newPrefixCache(budget int64, spillDir string) (*prefixCache, error) {
+	if spillDir != "" {
+		if err := clearSpillDir(spillDir); err != nil {
+			return nil, err
+		}
+	}
+	return &prefixCache{
+		budget:   budget,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		spillDir: spillDir,
+		spillGen: time.Now().UnixNano(),
+	}, nil
+}
+
+// Makes the spill dir and removes the spill files in it, once per process.
+func clearSpillDir(dir string) error {
+	spillCleared.Lock()
+	defer spillCleared.Unlock()
+	dir = filepath.Clean(dir)
+	if spillCleared.dirs[dir] {
+		return nil
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return util.Handle("Error in making cache spill dir", err)
+	}
+	old, err := filepath.Glob(filepath.Join(dir, "*.gob"))
+	if err != nil {
+		return util.Handle("Error in listing cache spill files", err)
+	}
+	for _, path := range old {
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return util.Handle("Error in clearing cache spill dir", err)
+		}
+	}
+	spillCleared.dirs[dir] = true
+	return nil
+}
+
+// get returns the cached result for a key. Checks the spill directory if the
+// key isn't in memory.
+func (c *prefixCache) get(key string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, present := c.items[key]; present {
+		c.order.MoveToFront(elem)
+		c.hits++
+		metrics.CacheLookups.WithLabelValues("hit").Inc()
+		return elem.Value.(*cacheEntry).res, true
+	}
+	if res, ok := c.readSpill(key); ok {
+		c.spillHits++
+		metrics.CacheLookups.WithLabelValues("spill_hit").Inc()
+		c.putLocked(key, res)
+		return res, true
+	}
+	c.misses++
+	metrics.CacheLookups.WithLabelValues("miss").Inc()
+	return Result{}, false
+}
+
+// put adds a result to the cache, evicting the least recently used results
+// until it fits in the budget. The newest result is always kept even if it
+// is bigger than the whole budget.
+func (c *prefixCache) put(key string, res Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.putLocked(key, res)
+}
+
+// putLocked is put for callers already holding the lock.
+func (c *prefixCache) putLocked(key string, res Result) {
+	if elem, present := c.items[key]; present {
+		c.size -= elem.Value.(*cacheEntry).size
+		c.order.Remove(elem)
+		delete(c.items, key)
+	}
+	entry := &cacheEntry{key, res, resultSize(key, res)}
+	c.items[key] = c.order.PushFront(entry)
+	c.size += entry.size
+	for c.size > c.budget && c.order.Len() > 1 {
+		c.evict(c.order.Back())
+	}
+}
+
+// Removes an entry from memory and writes it to the spill dir if enabled.
+func (c *prefixCache) evict(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.order.Remove(elem)
+	delete(c.items, entry.key)
+	c.size -= entry.size
+	c.evictions++
+	if c.spillDir != "" {
+		c.writeSpill(entry.key, entry.res)
+	}
+}
+
+// Path of the spill file for a key. Keys contain slashes so they're hex
+// encoded.
+func (c *prefixCache) spillPath(key string) string {
+	return filepath.Join(c.spillDir, fmt.Sprintf("%d-%x.gob", c.spillGen,
+		key))
+}
+
+// Writes a result to the spill dir, replacing any earlier copy. Failures
+// only cost a re-search later so they are just logged.
+func (c *prefixCache) writeSpill(key string, res Result) {
+	path := c.spillPath(key)
+	f, err := os.Create(path)
+	if err != nil {
+		util.Handle("Error in creating cache spill file", err)
+		return
+	}
+	defer f.Close()
+	out := spilledResult{}
+	for _, iv := range res.Intervals {
+		out.Starts = append(out.Starts, iv.Start)
+		out.Ends = append(out.Ends, iv.End)
+		out.Files = append(out.Files, iv.Files)
+	}
+	if err = gob.NewEncoder(f).Encode(out); err != nil {
+		util.Handle("Error in writing cache spill file", err)
+		os.Remove(path)
+	}
+}
+
+// Reads a result back from the spill dir.
+func (c *prefixCache) readSpill(key string) (Result, bool) {
+	if c.spillDir == "" {
+		return Result{}, false
+	}
+	f, err := os.Open(c.spillPath(key))
+	if err != nil {
+		return Result{}, false
+	}
+	defer f.Close()
+	in := spilledResult{}
+	if err = gob.NewDecoder(f).Decode(&in); err != nil {
+		util.Handle("Error in reading cache spill file", err)
+		return Result{}, false
+	}
+	intervals := make([]ranges.Interval, len(in.Starts))
+	for i := range in.Starts {
+		intervals[i] = ranges.Interval{Start: in.Starts[i], End: in.Ends[i],
+			Files: in.Files[i]}
+	}
+	maxEnd := ranges.Sort(intervals)
+	return Result{intervals, maxEnd}, true
+}
+
+// resultSize estimates the memory used by a cached result. Counts string
+// bytes plus rough overhead for headers and map entries.
+func resultSize(key string, res Result) int64 {
+	size := int64(len(key)) + 64
+	for _, iv := range res.Intervals {
+		size += 48 // start, end, maxEnd, and files header
+		for _, f := range iv.Files {
+			size += int64(len(f)) + 16
+		}
+	}
+	return size
+}
+
+// stats gives a summary of the cache usage.
+func (c *prefixCache) stats() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := c.hits + c.spillHits + c.misses
+	rate := 0.0
+	if total > 0 {
+		rate = float64(c.hits+c.spillHits) / float64(total) * 100
+	}
+	return fmt.Sprintf("Cache: %d hits, %d spill hits, %d misses (%.1f%% hit "+
+		"rate), %d evictions, %d entries using ~%d MB of %d MB", c.hits,
+		c.spillHits, c.misses, rate, c.evictions, c.order.Len(),
+		c.size/(1<<20), c.budget/(1<<20))
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/ranges"
+)
+
+// Makes a result with a single interval in a file.
+func testResult(start, end int, file string) Result {
+	intervals := []ranges.Interval{{Start: start, End: end,
+		Files: []string{file}}}
+	return Result{intervals, ranges.Sort(intervals)}
+}
+
+func TestPrefixCacheSpill(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newPrefixCache(0, dir) // Spills everything but the newest
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.put("a/NM_", testResult(1, 5, "/old"))
+	c.put("a/XP_", testResult(1, 1, "/x"))
+	res, ok := c.get("a/NM_")
+	if !ok || res.Intervals[0].Files[0] != "/old" || c.spillHits != 1 {
+		t.Fatalf("Got %v, %v. Want the spilled result", res, ok)
+	}
+	// Spilled again with new contents.
+	c.put("a/NM_", testResult(1, 5, "/new"))
+	c.put("a/XP_", testResult(1, 1, "/x"))
+	if res, ok = c.get("a/NM_"); !ok || res.Intervals[0].Files[0] != "/new" {
+		t.Errorf("Got %v, %v. Want the overwritten result", res, ok)
+	}
+
+	// A new cache for a reload doesn't see the old results or remove them.
+	c.put("a/XP_", testResult(1, 1, "/x"))
+	next, err := newPrefixCache(0, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, ok = next.get("a/NM_"); ok {
+		t.Errorf("Got stale result %v from an earlier cache", res)
+	}
+	if res, ok = c.get("a/NM_"); !ok || res.Intervals[0].Files[0] != "/new" {
+		t.Errorf("Got %v, %v. Want the serving cache's spill kept", res, ok)
+	}
+}
+
+// Spill files from an earlier run are cleared.
+func TestPrefixCacheSpillCleared(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "1-00.gob")
+	if err := ioutil.WriteFile(old, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newPrefixCache(0, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Left %s from an earlier run", old)
+	}
+}
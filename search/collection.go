@@ -0,0 +1,146 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// A Collection is a named directory of reduced accession files to search,
+// along with the rules for which prefixes get routed to it. New sources (WGS,
+// TSA, PDB, etc.) can be added by listing them in the collections file.
+type Collection struct {
+	Name     string   `json:"name"`     // Label reported with matches
+	Dir      string   `json:"dir"`      // Directory of reduced files
+	Priority int      `json:"priority"` // Lower values are searched first
+	Patterns []string `json:"patterns"` // Prefix must match one of these
+	Exclude  []string `json:"exclude"`  // Prefix must match none of these
+	MolType  string   `json:"molType"`  // "nucleotide", "protein", or any
+	Source   string   `json:"source"`   // Remote folder of the source files
+
+	patterns []*regexp.Regexp
+	exclude  []*regexp.Regexp
+}
+
+// Example collections file (JSON):
+// [
+//   {"name": "refseq", "dir": "/home/me/sequence_lists/refseq_trimmed",
+//    "priority": 1, "patterns": ["_"], "source": "/refseq/release"},
+//   {"name": "genbank", "dir": "/home/me/sequence_lists/genbank_reduced",
+//    "priority": 2, "exclude": ["_"], "source": "/genbank"}
+// ]
+
+// DefaultCollections gives the original GenBank and RefSeq search setup.
+// Underscores are only found in RefSeq prefixes.
+func DefaultCollections(home string) ([]Collection, error) {
+	res := []Collection{
+		{
+			Name:     "genbank",
+			Dir:      home + "/sequence_lists/genbank_reduced",
+			Priority: 1,
+			Exclude:  []string{"_"},
+			Source:   "/genbank",
+		},
+		{
+			Name:     "refseq",
+			Dir:      home + "/sequence_lists/refseq_trimmed",
+			Priority: 2,
+			Patterns: []string{"_"},
+			Source:   "/refseq/release",
+		},
+	}
+	return prepareCollections(res)
+}
+
+// LoadCollections reads the collections from a JSON file. Falls back to the
+// default GenBank/RefSeq collections if the file doesn't exist.
+func LoadCollections(path string, home string) ([]Collection, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return DefaultCollections(home)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.Handle("Error in reading collections file", err)
+	}
+	res := []Collection{}
+	if err = json.Unmarshal(data, &res); err != nil {
+		parseErr := &util.ParseError{File: path, Err: err}
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			parseErr.Line = bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+		}
+		return nil, util.Handle("Error in parsing collections file", parseErr)
+	}
+	return prepareCollections(res)
+}
+
+// prepareCollections compiles the routing patterns and orders the
+// collections by priority. Ties keep their order from the file.
+func prepareCollections(colls []Collection) ([]Collection, error) {
+	var err error
+	for i := range colls {
+		c := &colls[i]
+		if c.Name == "" {
+			c.Name = c.Dir
+		}
+		if c.patterns, err = compilePatterns(c.Patterns); err != nil {
+			return nil, util.Handle("Error in patterns for "+c.Name, err)
+		}
+		if c.exclude, err = compilePatterns(c.Exclude); err != nil {
+			return nil, util.Handle("Error in exclude patterns for "+c.Name, err)
+		}
+	}
+	sort.SliceStable(colls, func(i, j int) bool {
+		return colls[i].Priority < colls[j].Priority
+	})
+	return colls, err
+}
+
+// Compiles a list of regex strings.
+func compilePatterns(input []string) ([]*regexp.Regexp, error) {
+	res := []*regexp.Regexp{}
+	for _, p := range input {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// SourceFile gets the remote path of the source file for a searched file
+// name from the match results. E.g. /complete/x.faa.gz.trimmed ->
+// /refseq/release/complete/x.faa.gz.
+func (c *Collection) SourceFile(name string) string {
+	name = strings.TrimSuffix(name, ".txt")
+	name = strings.TrimSuffix(name, ".trimmed")
+	return c.Source + name
+}
+
+// Routes checks if a prefix (and optional molecule type) should be searched
+// for in this collection. No patterns means any prefix is accepted.
+func (c *Collection) Routes(prefix string, molType string) bool {
+	if molType != "" && c.MolType != "" && molType != c.MolType {
+		return false
+	}
+	for _, re := range c.exclude {
+		if re.MatchString(prefix) {
+			return false
+		}
+	}
+	if len(c.patterns) == 0 {
+		return true
+	}
+	for _, re := range c.patterns {
+		if re.MatchString(prefix) {
+			return true
+		}
+	}
+	return false
+}
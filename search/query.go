@@ -0,0 +1,102 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/ranges"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// A Query is a parsed ad hoc query: a single accession, a range of
+// accessions, or every accession with a prefix.
+type Query struct {
+	Input    string // As given
+	Prefix   string
+	Low      int
+	High     int
+	Wildcard bool // Whole prefix. E.g. NM_*
+}
+
+// ParseQuery parses queries like NM_000123, NM_000123.1, XP_5000-XP_6000,
+// XP_5000-6000, and NM_*.
+func ParseQuery(input string) (Query, error) {
+	q := Query{Input: input}
+	if strings.HasSuffix(input, "*") {
+		q.Prefix = strings.TrimSuffix(input, "*")
+		if q.Prefix == "" || strings.ContainsAny(q.Prefix, "0123456789") {
+			return q, errors.New("wildcards are only supported after the " +
+				"prefix. E.g. NM_*")
+		}
+		q.Wildcard = true
+		return q, nil
+	}
+	p := strings.Split(input, "-")
+	prefix, low, err := accession.Split(p[0])
+	if err != nil || prefix == "" {
+		return q, fmt.Errorf("couldn't parse accession %s", p[0])
+	}
+	q.Prefix, q.Low, q.High = prefix, low, low
+	if len(p) == 1 {
+		return q, nil
+	}
+	endPrefix, high, err := accession.Split(p[1])
+	if len(p) > 2 || err != nil || (endPrefix != "" && endPrefix != prefix) ||
+		high < low {
+		return q, fmt.Errorf("couldn't parse accession range %s", input)
+	}
+	q.High = high
+	return q, nil
+}
+
+// Lookup finds the locations for a query. Single accessions go through
+// Search so the match mode applies. Ranges and wildcards list every
+// overlapping interval in every collection the prefix routes to.
+func (s *Searcher) Lookup(ctx context.Context, q Query) ([]Match, error) {
+	defer observeLookup(q, time.Now())
+	if !q.Wildcard && q.Low == q.High {
+		return s.Search(ctx, q.Prefix, q.Low)
+	}
+	res := []Match{}
+	for i := range s.collections {
+		coll := &s.collections[i]
+		if !coll.Routes(q.Prefix, s.molType) {
+			continue
+		}
+		prefixRes, err := s.PrefixResults(ctx, coll, q.Prefix)
+		if err != nil {
+			return res, util.Handle("Error in searching collection "+coll.Name,
+				err)
+		}
+		idx := []int{}
+		if q.Wildcard {
+			for i := range prefixRes.Intervals {
+				idx = append(idx, i)
+			}
+		} else {
+			idx = ranges.SearchOverlaps(prefixRes.Intervals, prefixRes.MaxEnd,
+				q.Low, q.High)
+		}
+		for _, i := range idx {
+			res = append(res, intervalMatches(prefixRes.Intervals[i], coll)...)
+		}
+	}
+	return res, nil
+}
+
+// observeLookup records the latency of a lookup by its kind.
+func observeLookup(q Query, start time.Time) {
+	kind := "range"
+	if q.Wildcard {
+		kind = "wildcard"
+	} else if q.Low == q.High {
+		kind = "single"
+	}
+	metrics.LookupSeconds.WithLabelValues(kind).Observe(
+		time.Since(start).Seconds())
+}
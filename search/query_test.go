@@ -0,0 +1,35 @@
+package search
+
+import "testing"
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Query
+		ok    bool
+	}{
+		{"NM_000123", Query{Prefix: "NM_", Low: 123, High: 123}, true},
+		{"NM_000123.1", Query{Prefix: "NM_", Low: 123, High: 123}, true},
+		{"XP_5000-XP_6000", Query{Prefix: "XP_", Low: 5000, High: 6000}, true},
+		{"XP_5000-6000", Query{Prefix: "XP_", Low: 5000, High: 6000}, true},
+		{"NM_*", Query{Prefix: "NM_", Wildcard: true}, true},
+		{"XP_6000-XP_5000", Query{}, false},
+		{"XP_5000-NM_6000", Query{}, false},
+		{"XP_1-XP_2-XP_3", Query{}, false},
+		{"NM_1*", Query{}, false},
+		{"*", Query{}, false},
+		{"12345", Query{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseQuery(tt.input)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseQuery(%q) error %v. Want ok %v", tt.input, err,
+				tt.ok)
+			continue
+		}
+		tt.want.Input = tt.input
+		if err == nil && got != tt.want {
+			t.Errorf("ParseQuery(%q) = %+v. Want %+v", tt.input, got, tt.want)
+		}
+	}
+}
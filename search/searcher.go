@@ -0,0 +1,304 @@
+// Package search matches accession numbers to the smaller files they're
+// found in. Files are grouped into collections (see Collection), searched
+// with sift, and the results for each prefix are cached as sorted intervals.
+//
+// Example:
+//
+//	colls, err := search.LoadCollections(home+"/sequence_lists/collections.json", home)
+//	s, err := search.New(search.Config{Collections: colls,
+//	    MatchMode: search.MatchFirst, CacheBytes: 1 << 30})
+//	matches, err := s.Search(ctx, "NM_", 123)
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/ranges"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+	"golang.org/x/sync/singleflight"
+)
+
+// Longest a sift search of one prefix in a collection can take.
+const siftTimeout = 30 * time.Minute
+
+// Modes for which locations get reported when an accession is in more than
+// one file or collection.
+const (
+	MatchFirst    = "first"    // Only the first location found
+	MatchAll      = "all"      // Every location in every collection
+	MatchPriority = "priority" // Every location in the best collection
+)
+
+// A Match is a location where an accession number was found.
+type Match struct {
+	Found      string // Value or range that matched
+	Collection string // Name of the collection it was found in
+	File       string // File it was found in
+}
+
+// String formats a match for the results file.
+func (m Match) String() string {
+	return fmt.Sprintf("%-13s | %-10s | %s", m.Found, m.Collection, m.File)
+}
+
+// Config has the settings for a Searcher.
+type Config struct {
+	Collections []Collection // Search collections in priority order
+	MolType     string       // Molecule type of the queries, if known
+	MatchMode   string       // One of MatchFirst, MatchAll, MatchPriority
+	CacheBytes  int64        // Memory budget for cached prefix results
+	CacheSpill  string       // Directory for evicted results, if set
+}
+
+// A Searcher matches accessions to locations in its collections. Safe for
+// concurrent use.
+type Searcher struct {
+	collections []Collection
+	molType     string
+	matchMode   string
+	cache       *prefixCache
+	flight      singleflight.Group // Searches in progress by cache key
+
+	mu         sync.Mutex
+	duplicates map[string]int // Counts of sequences in multiple locations by prefix
+}
+
+// New sets up a Searcher from a Config.
+func New(conf Config) (*Searcher, error) {
+	if conf.MatchMode != MatchFirst && conf.MatchMode != MatchAll &&
+		conf.MatchMode != MatchPriority {
+		return nil, util.Handle("Unknown match mode", errors.New(conf.MatchMode))
+	}
+	if conf.MolType != "" && conf.MolType != "nucleotide" &&
+		conf.MolType != "protein" {
+		return nil, util.Handle("Unknown molecule type", errors.New(conf.MolType))
+	}
+	cache, err := newPrefixCache(conf.CacheBytes, conf.CacheSpill)
+	if err != nil {
+		return nil, util.Handle("Error in setting up prefix cache", err)
+	}
+	return &Searcher{
+		collections: conf.Collections,
+		molType:     conf.MolType,
+		matchMode:   conf.MatchMode,
+		cache:       cache,
+		duplicates:  make(map[string]int),
+	}, err
+}
+
+// Collections gives the search collections in priority order.
+func (s *Searcher) Collections() []Collection {
+	return s.collections
+}
+
+// Duplicates gives the counts of searched accessions found in more than one
+// location, by prefix. Only complete in MatchAll mode. The other modes stop
+// at the first collection with a match, so duplicates in lower priority
+// collections aren't seen.
+func (s *Searcher) Duplicates() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make(map[string]int)
+	for k, v := range s.duplicates {
+		res[k] = v
+	}
+	return res
+}
+
+// CacheStats gives a summary of the prefix cache usage.
+func (s *Searcher) CacheStats() string {
+	return s.cache.stats()
+}
+
+// A Result represents the matches from searching for a prefix in one
+// collection.
+// - Intervals are the number values/ranges found with the same prefix, with
+// the files each was found in, sorted ascending. The same range can show up
+// in more than one file.
+// - MaxEnd is the running max of the interval ends, for finding overlapping
+// ranges.
+type Result struct {
+	Intervals []ranges.Interval
+	MaxEnd    []int
+}
+
+// Lookup returns the intervals (with their files) that contain num.
+func (r *Result) Lookup(num int) []ranges.Interval {
+	res := []ranges.Interval{}
+	for _, i := range ranges.Search(r.Intervals, r.MaxEnd, num) {
+		res = append(res, r.Intervals[i])
+	}
+	return res
+}
+
+// PrefixResults gets the results of a search for a prefix to all the
+// matching accession numbers in a collection's search directory. Concurrent
+// calls for the same prefix and collection share one search. If ctx is
+// cancelled, the search utility is stopped and nothing is cached.
+func (s *Searcher) PrefixResults(ctx context.Context, coll *Collection,
+	prefix string) (Result, error) {
+	cacheKey := coll.Name + "/" + prefix
+	if res, present := s.cache.get(cacheKey); present {
+		return res, nil
+	}
+	for {
+		res, err, _ := s.flight.Do(cacheKey, func() (interface{}, error) {
+			return s.searchPrefix(ctx, coll, prefix, cacheKey)
+		})
+		if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+			continue // The caller that searched went away. Search again.
+		}
+		return res.(Result), err
+	}
+}
+
+// searchPrefix runs the search utility for a prefix in a collection and
+// caches the results under cacheKey.
+func (s *Searcher) searchPrefix(ctx context.Context, coll *Collection,
+	prefix string, cacheKey string) (Result, error) {
+	// Setup
+	var err error
+	var res Result
+	intervals := []ranges.Interval{}
+	keyToIndex := make(map[string]int)
+
+	// Get results from disk by calling sift. Parse each num/range in the
+	// output once and collect the files it was found in.
+	sift := util.Cmd{Args: []string{"sift", prefix, coll.Dir, "-w",
+		"--binary-skip"}, Timeout: siftTimeout}
+	err = util.Lines(ctx, func(line string) error {
+		if !strings.Contains(line, ": ") {
+			return nil
+		}
+		pieces := strings.Split(line, ": ")
+		key := pieces[1]
+		// Format the file names:lines
+		snip := pieces[0][len(coll.Dir):]
+		snip = snip[:len(snip)-len(prefix)-1]
+		if idx, present := keyToIndex[key]; present {
+			intervals[idx].Files = append(intervals[idx].Files, snip)
+			return nil
+		}
+		iv, err := ranges.Parse(key)
+		if err != nil {
+			return util.Handle("Error in parsing search result",
+				&util.ParseError{File: coll.Dir + snip, Text: key, Err: err})
+		}
+		iv.Files = []string{snip}
+		keyToIndex[key] = len(intervals)
+		intervals = append(intervals, iv)
+		return nil
+	}, sift)
+	if noMatches(err) {
+		err = nil // Cached as an empty result like any other.
+	} else if err != nil {
+		return res, util.Handle("Error in calling search utility", err)
+	}
+
+	util.Log(ctx).Debug("Searched collection", "collection", coll.Name,
+		"intervals", len(intervals))
+
+	// Add to cache
+	maxEnd := ranges.Sort(intervals)
+	res = Result{intervals, maxEnd}
+	s.cache.put(cacheKey, res)
+
+	return res, err
+}
+
+// noMatches checks if sift failed only because nothing matched. Like grep,
+// it exits with status 1 and no error output. 2 and up are real errors.
+func noMatches(err error) bool {
+	var toolErr *util.ExternalToolError
+	return errors.As(err, &toolErr) && toolErr.ExitCode == 1 &&
+		toolErr.Stderr == ""
+}
+
+// Search matches a single prefix and target num to matches in the search
+// collections. Collections are tried in priority order. Which of the
+// locations get returned depends on the match mode.
+func (s *Searcher) Search(ctx context.Context, prefix string,
+	targetNum int) ([]Match, error) {
+	res := []Match{}
+	for i := range s.collections {
+		coll := &s.collections[i]
+		if !coll.Routes(prefix, s.molType) {
+			continue
+		}
+		found, err := s.collectionSearch(ctx, coll, prefix, targetNum)
+		if err != nil {
+			return nil, util.Handle("Error in searching collection "+coll.Name,
+				err)
+		}
+		res = append(res, found...)
+		if len(res) > 0 && s.matchMode != MatchAll {
+			break // Stop at the first (best) collection with a match.
+		}
+	}
+	if len(res) > 1 {
+		s.mu.Lock()
+		s.duplicates[prefix] += 1
+		s.mu.Unlock()
+	}
+	if len(res) > 1 && s.matchMode == MatchFirst {
+		res = res[:1]
+	}
+	return res, nil
+}
+
+// collectionSearch matches a single prefix and target num to all the
+// locations in one collection.
+func (s *Searcher) collectionSearch(ctx context.Context, coll *Collection,
+	prefix string, targetNum int) ([]Match, error) {
+	res := []Match{}
+	prefixRes, err := s.PrefixResults(ctx, coll, prefix)
+	if err != nil {
+		return res, util.Handle("Error in getting file results for the prefix",
+			err)
+	}
+
+	// Format results
+	for _, iv := range prefixRes.Lookup(targetNum) {
+		res = append(res, intervalMatches(iv, coll)...)
+	}
+	return res, err
+}
+
+// Formats the matches for each file of an interval. File names have the
+// .txt dropped.
+func intervalMatches(iv ranges.Interval, coll *Collection) []Match {
+	res := []Match{}
+	for _, resFile := range iv.Files {
+		resFile = resFile[:len(resFile)-4]
+		res = append(res, Match{iv.String(), coll.Name, resFile})
+	}
+	return res
+}
+
+// RoutedResults gets the search results for a prefix from every collection
+// it routes to, by collection name. Collections without any results for the
+// prefix are left out.
+func (s *Searcher) RoutedResults(ctx context.Context, prefix string) (
+	map[string]Result, error) {
+	res := make(map[string]Result)
+	for i := range s.collections {
+		coll := &s.collections[i]
+		if !coll.Routes(prefix, s.molType) {
+			continue
+		}
+		prefixRes, err := s.PrefixResults(ctx, coll, prefix)
+		if err != nil {
+			return res, util.Handle("Error in searching collection "+coll.Name,
+				err)
+		}
+		if len(prefixRes.Intervals) > 0 {
+			res[coll.Name] = prefixRes
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,180 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// fakeSift puts a sift script first on the PATH. It gets sift's arguments
+// (prefix, dir, flags) as $1, $2, ... and appends each call to the calls
+// file it returns.
+func fakeSift(t *testing.T, script string) string {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script = "#!/bin/sh\necho \"$1 $2\" >> " + calls + "\n" + script + "\n"
+	err := ioutil.WriteFile(filepath.Join(dir, "sift"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+// Counts the sift calls so far.
+func siftCalls(t *testing.T, calls string) int {
+	data, err := ioutil.ReadFile(calls)
+	if os.IsNotExist(err) {
+		return 0
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+// Makes a searcher over collections "a" (searched first) and "b" in dirs
+// /a and /b.
+func newTestSearcher(t *testing.T, mode string) *Searcher {
+	colls, err := prepareCollections([]Collection{
+		{Name: "a", Dir: "/a", Priority: 1},
+		{Name: "b", Dir: "/b", Priority: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Config{Collections: colls, MatchMode: mode,
+		CacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPrefixResultsNoMatches(t *testing.T) {
+	calls := fakeSift(t, "exit 1") // Nothing found, like grep
+	s := newTestSearcher(t, MatchFirst)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		res, err := s.PrefixResults(ctx, &s.collections[0], "NM_")
+		if err != nil || len(res.Intervals) != 0 {
+			t.Fatalf("Got %v, %v. Want an empty result", res, err)
+		}
+	}
+	if n := siftCalls(t, calls); n != 1 {
+		t.Errorf("sift ran %d times. Want the empty result cached", n)
+	}
+}
+
+func TestPrefixResultsShared(t *testing.T) {
+	calls := fakeSift(t, `sleep 0.2; echo "$2/x.txt:$1: 5-10"`)
+	s := newTestSearcher(t, MatchFirst)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.PrefixResults(context.Background(),
+				&s.collections[0], "NM_")
+			if err != nil || len(res.Intervals) != 1 {
+				t.Errorf("Got %v, %v. Want one interval", res, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := siftCalls(t, calls); n != 1 {
+		t.Errorf("sift ran %d times. Want one shared search", n)
+	}
+}
+
+// A search shared with a caller that goes away is run again for the others.
+func TestPrefixResultsSharedCancel(t *testing.T) {
+	calls := fakeSift(t, `sleep 0.3; echo "$2/x.txt:$1: 5-10"`)
+	s := newTestSearcher(t, MatchFirst)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.PrefixResults(ctx, &s.collections[0], "NM_")
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond) // Let it start the search
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	res, err := s.PrefixResults(context.Background(), &s.collections[0], "NM_")
+	if err != nil || len(res.Intervals) != 1 {
+		t.Errorf("Got %v, %v. Want one interval", res, err)
+	}
+	if err = <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancelled caller got %v", err)
+	}
+	if n := siftCalls(t, calls); n != 2 {
+		t.Errorf("sift ran %d times. Want the search run again", n)
+	}
+}
+
+func TestPrefixResultsSiftError(t *testing.T) {
+	fakeSift(t, "echo 'bad flag' >&2; exit 2")
+	s := newTestSearcher(t, MatchFirst)
+	_, err := s.PrefixResults(context.Background(), &s.collections[0], "NM_")
+	var toolErr *util.ExternalToolError
+	if !errors.As(err, &toolErr) || toolErr.ExitCode != 2 {
+		t.Errorf("Got error %v. Want sift's exit status 2", err)
+	}
+}
+
+func TestSearchFallsBackToNextCollection(t *testing.T) {
+	// Only collection b has NM_ 5-10.
+	fakeSift(t, `if [ "$2" = /b ]; then echo "/b/x.txt:$1: 5-10"; exit 0; fi
+exit 1`)
+	s := newTestSearcher(t, MatchFirst)
+	res, err := s.Search(context.Background(), "NM_", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Match{Found: "5-10", Collection: "b", File: "/x"}
+	if len(res) != 1 || res[0] != want {
+		t.Errorf("Got %v. Want %v", res, want)
+	}
+}
+
+func TestSearchMolType(t *testing.T) {
+	fakeSift(t, `echo "$2/x.txt:$1: 5-10"`) // Every collection has it
+	colls, err := prepareCollections([]Collection{
+		{Name: "a", Dir: "/a", Priority: 1, MolType: "nucleotide"},
+		{Name: "b", Dir: "/b", Priority: 2, MolType: "protein"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		molType string
+		want    string // Collection found in
+	}{
+		{"", "a"},
+		{"nucleotide", "a"},
+		{"protein", "b"},
+	}
+	for _, tt := range tests {
+		s, err := New(Config{Collections: colls, MolType: tt.molType,
+			MatchMode: MatchFirst, CacheBytes: 1 << 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := s.Search(context.Background(), "NM_", 7)
+		if err != nil || len(res) != 1 || res[0].Collection != tt.want {
+			t.Errorf("Mol type %q got %v, %v. Want a match in %s", tt.molType,
+				res, err, tt.want)
+		}
+	}
+	_, err = New(Config{MolType: "rna", MatchMode: MatchFirst})
+	if err == nil {
+		t.Error("Want an error for an unknown molecule type")
+	}
+}
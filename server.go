@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/metrics"
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+	"google.golang.org/grpc"
+)
+
+// Most queries accepted in one batch request.
+const maxBatchQueries = 100000
+
+// Largest batch request body. Room for maxBatchQueries long queries.
+const maxBatchBytes = 16 << 20
+
+// How long requests in progress get to finish on shutdown.
+const shutdownGrace = 30 * time.Second
+
+// lookupServer answers lookups over HTTP from the same search setup as the
+// lookup command. The setup is rebuilt when a new index build is published.
+type lookupServer struct {
+	mu        sync.RWMutex
+	searcher  lookuper  // Current search setup. nil until loaded
+	published time.Time // Mod time of the publish file for searcher
+	home      string
+}
+
+// lookuper is the part of search.Searcher the server uses. Tests can use a
+// small in-memory one.
+type lookuper interface {
+	Lookup(ctx context.Context, q search.Query) ([]search.Match, error)
+}
+
+// A lookupMatch is one location in a lookup response.
+type lookupMatch struct {
+	Found      string `json:"found"` // Matched value or range
+	Collection string `json:"collection"`
+	File       string `json:"file"`
+}
+
+// A lookupResult is the response for one query.
+type lookupResult struct {
+	Query   string        `json:"query"`
+	Matches []lookupMatch `json:"matches"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// A batchRequest is the body of a batch lookup.
+type batchRequest struct {
+	Queries []string `json:"queries"`
+}
+
+// serveCommand runs the HTTP lookup server until it fails or ctx is
+// cancelled, then lets requests in progress finish. Endpoints:
+// GET  /lookup?q=NM_000123&q=XP_5-XP_9  Single (or a few) lookups
+// POST /lookup/batch {"queries": [...]}  Batch lookups
+// GET  /healthz                          Process is up
+// GET  /readyz                           Index is loaded
+// GET  /metrics                          Prometheus metrics
+// Also serves the gRPC Lookup stream on grpcAddr if given. The index is
+// loaded after the server starts, so /healthz answers while it loads. If the
+// first load or the gRPC server fails, the servers are shut down the same way
+// and the error is returned.
+func serveCommand(ctx context.Context, addr string, grpcAddr string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	failed := make(chan error, 2)
+	s := &lookupServer{home: util.UserHome()}
+	go func() {
+		if err := s.reload(); err != nil {
+			failed <- util.Handle("Error in loading index", err)
+			cancel()
+			return
+		}
+		s.watchPublished(ctx, 30*time.Second)
+	}()
+	var grpcServer *grpc.Server
+	if grpcAddr != "" {
+		grpcServer = newGrpcServer(s)
+		go func() {
+			if err := serveGrpc(grpcServer, grpcAddr); err != nil {
+				failed <- err
+				cancel()
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lookup", s.handleLookup)
+	mux.HandleFunc("/lookup/batch", s.handleBatch)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", s.handleReady)
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	// Shut down on cancel
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		slog.Info("Shutting down lookup server.")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(),
+			shutdownGrace)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			util.Handle("Error in shutting down HTTP server", err)
+		}
+		if grpcServer != nil {
+			stopGrpc(grpcServer, shutdownGrace)
+		}
+	}()
+
+	slog.Info("Serving lookups", "addr", addr)
+	err := server.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+	slog.Info("Lookup server stopped.")
+	select {
+	case err = <-failed:
+		return err
+	default:
+		return nil
+	}
+}
+
+// stopGrpc lets open streams finish, up to grace, then closes them.
+func stopGrpc(server *grpc.Server, grace time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(grace):
+		server.Stop()
+	}
+}
+
+// publishFile is touched (or replaced) when a new index build is published.
+// Defaults to the collections file.
+func (s *lookupServer) publishFile() string {
+	if *publishFile != "" {
+		return *publishFile
+	}
+	return s.home + "/sequence_lists/collections.json"
+}
+
+// reload builds a new search setup and swaps it in. Lookups in progress, and
+// any that come in while it runs, keep using the old one.
+func (s *lookupServer) reload() error {
+	var published time.Time
+	if info, err := os.Stat(s.publishFile()); err == nil {
+		published = info.ModTime()
+	}
+	searcher, err := newSearcher(s.home)
+	if err != nil {
+		return util.Handle("Error in building search setup", err)
+	}
+	s.mu.Lock()
+	s.searcher = searcher
+	s.published = published
+	s.mu.Unlock()
+	slog.Info("Index loaded", "published", published)
+	return err
+}
+
+// watchPublished polls the publish file and reloads when it changes, until
+// ctx is cancelled.
+func (s *lookupServer) watchPublished(ctx context.Context,
+	every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(s.publishFile())
+		if err != nil {
+			continue
+		}
+		s.mu.RLock()
+		changed := !info.ModTime().Equal(s.published)
+		s.mu.RUnlock()
+		if changed {
+			if err = s.reload(); err != nil {
+				util.Handle("Error in reloading index. Keeping the old one", err)
+			}
+		}
+	}
+}
+
+// ready checks if the index is loaded. Stays ready during reloads since the
+// old index keeps answering.
+func (s *lookupServer) ready() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.searcher != nil
+}
+
+// current gets the search setup to use for a request.
+func (s *lookupServer) current() lookuper {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.searcher
+}
+
+// answer runs the lookups for a list of queries. Queries after ctx is
+// cancelled (e.g. the client went away) get its error.
+func (s *lookupServer) answer(ctx context.Context,
+	queries []string) []lookupResult {
+	searcher := s.current()
+	res := []lookupResult{}
+	if searcher == nil {
+		for _, input := range queries {
+			res = append(res, lookupResult{Query: input,
+				Matches: []lookupMatch{}, Error: "index not loaded"})
+		}
+		return res
+	}
+	for _, input := range queries {
+		r := lookupResult{Query: input, Matches: []lookupMatch{}}
+		ctx := util.WithLog(ctx, "query", input)
+		q, err := search.ParseQuery(input)
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			var matches []search.Match
+			matches, err = searcher.Lookup(ctx, q)
+			if err == nil && len(matches) == 0 {
+				metrics.NotFound.WithLabelValues("lookup").Inc()
+			}
+			for _, m := range matches {
+				r.Matches = append(r.Matches, lookupMatch{m.Found, m.Collection,
+					m.File})
+			}
+		}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+func (s *lookupServer) handleLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	queries := r.URL.Query()["q"]
+	if len(queries) == 0 {
+		http.Error(w, "missing q parameter", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, s.answer(r.Context(), queries))
+}
+
+func (s *lookupServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	req := batchRequest{}
+	body := http.MaxBytesReader(w, r.Body, maxBatchBytes)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "bad JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Queries) > maxBatchQueries {
+		http.Error(w, "too many queries", http.StatusRequestEntityTooLarge)
+		return
+	}
+	writeJSON(w, s.answer(r.Context(), req.Queries))
+}
+
+func (s *lookupServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !s.ready() {
+		http.Error(w, "index not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
+
+// Writes a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		util.Handle("Error in writing response", err)
+	}
+}
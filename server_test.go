@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+)
+
+func TestHandleReady(t *testing.T) {
+	loaded := fakeLookups{}
+	tests := []struct {
+		name     string
+		searcher lookuper
+		want     int
+	}{
+		{"not loaded", nil, http.StatusServiceUnavailable},
+		{"loaded", loaded, http.StatusOK},
+	}
+	for _, tt := range tests {
+		s := &lookupServer{searcher: tt.searcher}
+		w := httptest.NewRecorder()
+		s.handleReady(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: /readyz gave %d. Want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	s := &lookupServer{searcher: fakeLookups{
+		"NM_1": {{Found: "1", Collection: "refseq", File: "/a"}}}}
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"ok", `{"queries": ["NM_1"]}`, http.StatusOK},
+		{"bad JSON", `{"queries": [`, http.StatusBadRequest},
+		{"too large", `{"queries": ["` + strings.Repeat("x", maxBatchBytes) +
+			`"]}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.handleBatch(w, httptest.NewRequest(http.MethodPost, "/lookup/batch",
+			strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s: batch gave %d. Want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestAnswerNotLoaded(t *testing.T) {
+	s := &lookupServer{}
+	res := s.answer(t.Context(), []string{"NM_1"})
+	if len(res) != 1 || res[0].Error == "" {
+		t.Errorf("Got %+v. Want an error before the index is loaded", res)
+	}
+	s.searcher = fakeLookups{"NM_1": []search.Match{{Found: "1"}}}
+	if res = s.answer(t.Context(), []string{"NM_1"}); len(res[0].Matches) != 1 {
+		t.Errorf("Got %+v. Want a match once loaded", res)
+	}
+}
+
+// A failed first load stops the server and returns the error.
+func TestServeCommandLoadFails(t *testing.T) {
+	defer func(old string) { *molType = old }(*molType)
+	*molType = "rna" // Makes building the search setup fail
+	done := make(chan error)
+	go func() {
+		done <- serveCommand(t.Context(), "127.0.0.1:0", "")
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Want the load error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Server kept running after the load failed")
+	}
+}
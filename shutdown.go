@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// signalContext gives a context that is cancelled on Ctrl-C or SIGTERM. Long
+// runs then stop starting new work, stop their child processes (rsync, sift),
+// and remove partial files. A second signal exits right away.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			slog.Warn("Stopping work in progress. Send again to exit right "+
+				"away.", "signal", sig.String())
+			signal.Stop(signals) // Default handling for the next one
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+		}
+	}()
+	return ctx, cancel
+}
+
+// A workSummary keeps track of the items of work in a run (e.g. files to
+// extract) for a summary at the end, or of what got done when interrupted.
+// Safe for concurrent use.
+type workSummary struct {
+	mu      sync.Mutex
+	name    string   // Name of the run
+	total   int      // Items to do
+	done    int      // Finished without errors
+	failed  []string // Failed on their own
+	stopped []string // In progress when cancelled
+}
+
+// newWorkSummary makes a summary for a run of total items.
+func newWorkSummary(name string, total int) *workSummary {
+	return &workSummary{name: name, total: total}
+}
+
+// record notes the result of an item. Errors after ctx was cancelled count
+// as stopped rather than failed.
+func (s *workSummary) record(ctx context.Context, item string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case err == nil:
+		s.done++
+	case ctx.Err() != nil:
+		s.stopped = append(s.stopped, item)
+	default:
+		s.failed = append(s.failed, item)
+	}
+}
+
+// print logs the summary. Warns if anything failed or was interrupted.
+func (s *workSummary) print(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notStarted := s.total - s.done - len(s.failed) - len(s.stopped)
+	level, status := slog.LevelInfo, "Finished"
+	if ctx.Err() != nil {
+		level, status = slog.LevelWarn, "Interrupted"
+	} else if len(s.failed) > 0 {
+		level = slog.LevelWarn
+	}
+	l := util.Log(ctx).With("run", s.name)
+	l.Log(ctx, level, status, "done", s.done, "total", s.total,
+		"failed", len(s.failed), "stopped", len(s.stopped),
+		"not_started", notStarted)
+	for _, item := range s.failed {
+		l.Warn("Failed", "item", item)
+	}
+	for _, item := range s.stopped {
+		l.Info("Stopped", "item", item)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/extract"
+	"github.com/chanzuckerberg/ncbi-tool-search/fetch"
+	"github.com/chanzuckerberg/ncbi-tool-search/ranges"
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// subsetCommand builds a FASTA of just the query sequences from the smaller
+// source files they were matched to. Empty paths default to the files of the
+// nr run under ~/sequence_lists/blast/db/FASTA.
+func subsetCommand(ctx context.Context, queries string, results string,
+	output string) error {
+	home := util.UserHome()
+	folder := home + "/sequence_lists/blast/db/FASTA/"
+	if queries == "" {
+		queries = folder + "query_accessions.txt"
+	}
+	if results == "" {
+		results = folder + "nr_run_1.txt"
+	}
+	if output == "" {
+		output = folder + "query_subset.fasta"
+	}
+	colls, err := loadCollections(home)
+	if err != nil {
+		return util.Handle("Error in loading search collections", err)
+	}
+	err = buildSubsetFasta(ctx, home, queries, results, colls, output)
+	if err != nil {
+		return util.Handle("Error in building subset FASTA", err)
+	}
+	return err
+}
+
+// buildSubsetFasta writes a FASTA to output with exactly the sequences in the
+// queries file, pulled from the source files they were matched to in the
+// results file from matchSequences. Source files are used from
+// home/source_files if present, otherwise downloaded with fetch.Rsync and
+// removed after. A source that fails is logged and skipped, and the records it
+// wrote are dropped. Queries that couldn't be retrieved, including those of
+// failed sources, are written to output.missing.txt. If ctx is cancelled or
+// the output can't be written, the partial output is removed. In a dry run
+// the downloads and outputs are only planned.
+func buildSubsetFasta(ctx context.Context, home string, queries string,
+	results string, colls []search.Collection, output string) error {
+	// Get the wanted accessions
+	format, err := accession.DetectFormat(queries)
+	if err != nil {
+		return util.Handle("Error in detecting query format", err)
+	}
+	stats := accession.Stats{Format: format}
+	byPrefix, err := accession.ReadQueries(ctx, queries, format, &stats, nil,
+		nil)
+	if err != nil {
+		return util.Handle("Error in reading queries", err)
+	}
+	util.Log(ctx).Info("Read queries", "stats", stats)
+	for _, nums := range byPrefix {
+		sort.Ints(nums)
+	}
+
+	// Group the wanted accessions by source file
+	toFetch, viaMember, err := subsetFilePlan(results, byPrefix, colls)
+	if err != nil {
+		return util.Handle("Error in reading match results", err)
+	}
+	if util.DryRun(ctx) {
+		for _, source := range sortedKeys(toFetch) {
+			if err = fetch.Rsync(ctx, home, source); err != nil {
+				return err
+			}
+		}
+		util.PlannedOutput(ctx, output, -1)
+		util.PlannedOutput(ctx, output+".missing.txt", -1)
+		return nil
+	}
+
+	outFile, err := os.Create(output)
+	if err != nil {
+		return util.Handle("Error in creating output FASTA", err)
+	}
+	defer outFile.Close()
+	out := bufio.NewWriter(outFile)
+	written := make(map[string]bool)
+	failed := 0
+	for _, source := range sortedKeys(toFetch) {
+		wanted := toFetch[source]
+		// Where this source's records start, to drop them if it fails.
+		var start int64
+		if err = out.Flush(); err == nil {
+			start, err = outFile.Seek(0, io.SeekCurrent)
+		}
+		if err != nil {
+			os.Remove(output)
+			return util.Handle("Error in writing output FASTA", err)
+		}
+		already := make(map[string]bool)
+		for key := range wanted {
+			already[key] = written[key]
+		}
+		err = subsetFromFile(ctx, home, source, wanted, written, out)
+		if ctx.Err() != nil {
+			os.Remove(output)
+			return ctx.Err()
+		}
+		if err == nil {
+			continue
+		}
+		util.Handle("Error in getting sequences from "+source+
+			". Its queries are listed as missing", err)
+		failed++
+		for key := range wanted {
+			if !already[key] {
+				delete(written, key)
+			}
+		}
+		out.Reset(outFile)
+		if err = outFile.Truncate(start); err == nil {
+			_, err = outFile.Seek(start, io.SeekStart)
+		}
+		if err != nil {
+			os.Remove(output)
+			return util.Handle("Error in dropping records of "+source, err)
+		}
+	}
+	if err = out.Flush(); err != nil {
+		os.Remove(output)
+		return util.Handle("Error in writing output FASTA", err)
+	}
+
+	// Report the ones that couldn't be retrieved
+	missing, err := os.Create(output + ".missing.txt")
+	if err != nil {
+		return util.Handle("Error in creating missing list", err)
+	}
+	defer missing.Close()
+	missingCount := 0
+	for _, prefix := range accession.SortedPrefixes(byPrefix) {
+		for _, num := range byPrefix[prefix] {
+			key := accession.Key(prefix, num)
+			if !written[key] && !written[viaMember[key]] {
+				missing.WriteString(key + "\n")
+				missingCount++
+			}
+		}
+	}
+	util.Log(ctx).Info("Wrote subset FASTA", "output", output,
+		"sequences", len(written), "missing", missingCount,
+		"failed_sources", failed)
+	return err
+}
+
+// subsetFilePlan reads a matchSequences results file and gives the remote
+// source files with the query accession keys to get from each. Each query is
+// only taken from the first file it was matched to. Results found through an
+// nr member ("via" lines) take the member accession from that file instead,
+// and the query to member keys are returned too.
+func subsetFilePlan(results string, byPrefix map[string][]int,
+	colls []search.Collection) (map[string]map[string]bool, map[string]string,
+	error) {
+	res := make(map[string]map[string]bool)
+	viaMember := make(map[string]string)
+	assigned := make(map[string]bool)
+	collByName := make(map[string]*search.Collection)
+	for i := range colls {
+		collByName[colls[i].Name] = &colls[i]
+	}
+	file, err := os.Open(results)
+	if err != nil {
+		return res, viaMember, util.Handle("Error in opening results file", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), " | ")
+		if len(cols) < 4 || strings.HasPrefix(cols[0], "Target") {
+			continue // Header or not found line
+		}
+		coll, present := collByName[strings.TrimSpace(cols[2])]
+		if !present {
+			continue
+		}
+		source := coll.SourceFile(strings.TrimSpace(cols[3]))
+		member := ""
+		for _, col := range cols[4:] {
+			if strings.HasPrefix(col, "via ") {
+				member = strings.TrimPrefix(col, "via ")
+			}
+		}
+		for _, key := range targetKeys(strings.TrimSpace(cols[0]), byPrefix) {
+			if assigned[key] {
+				continue
+			}
+			assigned[key] = true
+			if member != "" {
+				prefix, num, err := accession.Split(member)
+				if err != nil || prefix == "" {
+					continue
+				}
+				viaMember[key] = accession.Key(prefix, num)
+				key = viaMember[key]
+			}
+			if res[source] == nil {
+				res[source] = make(map[string]bool)
+			}
+			res[source][key] = true
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return res, viaMember, util.Handle("Error in reading results file", err)
+	}
+	return res, viaMember, err
+}
+
+// targetKeys gives the queried accession keys in a results target. E.g.
+// NP_5-9 with queries NP_5, NP_7 -> NP_5, NP_7.
+func targetKeys(target string, byPrefix map[string][]int) []string {
+	res := []string{}
+	p := strings.Split(target, "-")
+	prefix, start, err := accession.Split(p[0])
+	if err != nil || prefix == "" {
+		return res
+	}
+	iv := ranges.Interval{Start: start, End: start}
+	if len(p) > 1 {
+		if iv, err = ranges.Parse(fmt.Sprintf("%d-%s", start, p[1])); err != nil {
+			return res
+		}
+	}
+	nums := byPrefix[prefix]
+	for i := sort.SearchInts(nums, iv.Start); i < len(nums) &&
+		nums[i] <= iv.End; i++ {
+		res = append(res, accession.Key(prefix, nums[i]))
+	}
+	return res
+}
+
+// subsetFromFile streams one source file and writes out the FASTA records
+// for the wanted accession keys. Records already written aren't repeated.
+func subsetFromFile(ctx context.Context, home string, source string,
+	wanted map[string]bool, written map[string]bool, out *bufio.Writer) error {
+	local := fetch.LocalPath(home, source)
+	if _, err := os.Stat(local); err != nil {
+		// Not available locally. Fetch and remove after.
+		if err = fetch.Rsync(ctx, home, source); err != nil {
+			return util.Handle("Error in fetching source file", err)
+		}
+		defer os.Remove(local)
+	}
+	reader, closer, err := accession.OpenInput(local)
+	if err != nil {
+		return util.Handle("Error in opening source file", err)
+	}
+	defer closer()
+
+	// Marks the wanted keys in a list of accessions as written. True if any
+	// were wanted.
+	take := func(accessions []string) bool {
+		found := false
+		for _, acc := range accessions {
+			prefix, num, err := accession.Split(acc)
+			if err != nil || prefix == "" {
+				continue
+			}
+			key := accession.Key(prefix, num)
+			if wanted[key] && !written[key] {
+				written[key] = true
+				found = true
+			}
+		}
+		return found
+	}
+
+	if strings.Contains(source, "genbank") {
+		// GenBank flat files are converted to FASTA.
+		return extract.ParseGenbank(reader, source, true,
+			func(h extract.GenbankHeader) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				accessions := append([]string{h.Primary}, h.Secondary...)
+				for _, r := range h.Ranges {
+					err := accession.ExpandRange(r, func(acc string) {
+						accessions = append(accessions, acc)
+					})
+					if err != nil {
+						return err
+					}
+				}
+				if !take(accessions) {
+					return nil
+				}
+				name := h.Version
+				if name == "" {
+					name = h.Primary
+				}
+				out.WriteString(">" + name + " " + h.Definition + "\n")
+				for i := 0; i < len(h.Sequence); i += 70 {
+					end := i + 70
+					if end > len(h.Sequence) {
+						end = len(h.Sequence)
+					}
+					out.WriteString(strings.ToUpper(h.Sequence[i:end]) + "\n")
+				}
+				return nil
+			})
+	}
+
+	// FASTA records are copied as-is.
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 256*1024*1024)
+	keep := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ">") {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			keep = take(accession.FromFastaHeader(line))
+		}
+		if keep {
+			out.WriteString(line + "\n")
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return util.Handle("Error in reading source file", err)
+	}
+	return err
+}
+
+// sortedKeys gives the keys of a map of sets in order.
+func sortedKeys(input map[string]map[string]bool) []string {
+	res := []string{}
+	for k := range input {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/search"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// A GenBank record with its queried accession in an ACCESSION range.
+const subsetGenbank = `LOCUS       AB000001                  20 bp    DNA     linear   BCT 01-JAN-2000
+DEFINITION  Some gene.
+ACCESSION   AB000001 AB000010-AB000012
+VERSION     AB000001.2
+ORIGIN
+        1 acgtacgtac gtacgtacgt
+//
+`
+
+// Writes a file with its folders.
+func writeTestFile(t *testing.T, path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Gzips FASTA records with long random sequences, cut off partway so that
+// reading fails after some records.
+func truncatedGzip(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	rnd := rand.New(rand.NewSource(1))
+	for _, name := range names {
+		seq := make([]byte, 20000)
+		for i := range seq {
+			seq[i] = "ACGT"[rnd.Intn(4)]
+		}
+		gz.Write([]byte(">" + name + " desc\n" + string(seq) + "\n"))
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()[:buf.Len()*3/4]
+}
+
+// Makes source files under a temp home, with queries and match results for
+// them. Gives the home, queries, results, and collections.
+func subsetFixture(t *testing.T) (string, string, string,
+	[]search.Collection) {
+	home := t.TempDir()
+	src := home + "/source_files"
+	writeTestFile(t, src+"/refseq/a.faa",
+		[]byte(">NP_1.1 one\nMKV\n>NP_2.1 two\nMAA\n"))
+	writeTestFile(t, src+"/refseq/b.faa.gz",
+		truncatedGzip(t, "NP_3.1", "NP_4.1", "NP_5.1"))
+	writeTestFile(t, src+"/genbank/gbbct1.seq", []byte(subsetGenbank))
+	queries := home + "/queries.txt"
+	writeTestFile(t, queries,
+		[]byte("NP_1\nNP_3\nNP_4\nNP_5\nAB000011\nXP_9\n"))
+	results := home + "/results.txt"
+	writeTestFile(t, results, []byte(strings.Join([]string{
+		"Target          | Found in range | Collection | In file",
+		"NP_1            | 1-2 | refseq | /a.faa.txt",
+		"NP_3-5          | 3-5 | refseq | /b.faa.gz.txt",
+		"AB000011        | 11 | genbank | /gbbct1.seq.txt",
+		"XP_9 not found."}, "\n")+"\n"))
+	colls := []search.Collection{{Name: "refseq", Source: "/refseq"},
+		{Name: "genbank", Source: "/genbank"}}
+	return home, queries, results, colls
+}
+
+func TestBuildSubsetFasta(t *testing.T) {
+	home, queries, results, colls := subsetFixture(t)
+	output := home + "/subset.fasta"
+	err := buildSubsetFasta(context.Background(), home, queries, results,
+		colls, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing from the truncated source.
+	want := ">AB000001.2 Some gene.\nACGTACGTACGTACGTACGT\n>NP_1.1 one\nMKV\n"
+	if string(got) != want {
+		t.Errorf("Wrote %.200q. Want %q", got, want)
+	}
+	missing, err := ioutil.ReadFile(output + ".missing.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want = "NP_3\nNP_4\nNP_5\nXP_9\n"; string(missing) != want {
+		t.Errorf("Missing %q. Want %q", missing, want)
+	}
+}
+
+func TestBuildSubsetFastaDryRun(t *testing.T) {
+	home, queries, results, colls := subsetFixture(t)
+	output := home + "/subset.fasta"
+	plan := &util.Plan{}
+	ctx := util.WithPlan(context.Background(), plan)
+	err := buildSubsetFasta(ctx, home, queries, results, colls, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []util.PlanStep{{Kind: util.PlanCreate, Path: output, Bytes: -1},
+		{Kind: util.PlanCreate, Path: output + ".missing.txt", Bytes: -1}}
+	if !reflect.DeepEqual(plan.Steps, want) {
+		t.Errorf("Planned %+v. Want %+v", plan.Steps, want)
+	}
+	if _, err = os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("Wrote %s in a dry run", output)
+	}
+}
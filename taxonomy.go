@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+	"github.com/chanzuckerberg/ncbi-tool-search/util"
+)
+
+// loadTaxa loads the taxids of accessions with the query prefixes from the
+// -taxid-files, if given. The files cover every accession, so the rest are
+// left out to save memory.
+func loadTaxa(ctx context.Context, run *matchRun,
+	prefixes map[string]bool) error {
+	if *taxidFiles == "" {
+		return nil
+	}
+	paths := strings.Split(*taxidFiles, ",")
+	taxa, err := accession.LoadAccession2Taxid(ctx, paths, prefixes)
+	if err != nil {
+		return util.Handle("Error in loading accession2taxid files", err)
+	}
+	run.taxa = taxa
+	util.Log(ctx).Info("Loaded accession taxids", "count", len(taxa),
+		"prefixes", len(prefixes))
+	return err
+}
+
+// reducedPrefixes gets the prefixes in a reduced input file of "PREFIX: N"
+// and "PREFIX: A-B" lines. Reduced files are small next to the
+// accession2taxid files, so the extra pass is cheap.
+func reducedPrefixes(input string) (map[string]bool, error) {
+	reader, closer, err := accession.OpenInput(input)
+	if err != nil {
+		return nil, util.Handle("Error in opening input file.", err)
+	}
+	defer closer()
+	res := make(map[string]bool)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if prefix, _, found := strings.Cut(scanner.Text(), ": "); found {
+			res[prefix] = true
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, util.Handle("Error in reading input file.", err)
+	}
+	return res, err
+}
+
+// taxColumn formats the taxid column for a results line. Empty if no
+// taxonomy index is loaded.
+func taxColumn(run *matchRun, prefix string, num int) string {
+	if run.taxa == nil {
+		return ""
+	}
+	if taxid := run.taxa.Lookup(prefix, num); taxid != 0 {
+		return " | taxid " + strconv.Itoa(taxid)
+	}
+	return " | taxid -"
+}
+
+// rangeTaxColumn formats the taxid column for a range of accessions. The
+// taxid is only given if it's known and the same across the whole range.
+func rangeTaxColumn(run *matchRun, prefix string, start int, end int) string {
+	if run.taxa == nil {
+		return ""
+	}
+	taxid := run.taxa.Lookup(prefix, start)
+	for i := start + 1; i <= end && taxid != 0; i++ {
+		if run.taxa.Lookup(prefix, i) != taxid {
+			taxid = 0
+		}
+	}
+	if taxid != 0 {
+		return " | taxid " + strconv.Itoa(taxid)
+	}
+	return " | taxid -" // Unknown or differs within the range
+}
+
+// printTaxidCounts prints counts by taxid, largest first.
+func printTaxidCounts(counts map[int]int) {
+	taxids := []int{}
+	for k := range counts {
+		taxids = append(taxids, k)
+	}
+	sort.Slice(taxids, func(i, j int) bool {
+		if counts[taxids[i]] != counts[taxids[j]] {
+			return counts[taxids[i]] > counts[taxids[j]]
+		}
+		return taxids[i] < taxids[j]
+	})
+	for _, taxid := range taxids {
+		name := strconv.Itoa(taxid)
+		if taxid == 0 {
+			name = "unknown"
+		}
+		fmt.Println(name + ": " + strconv.Itoa(counts[taxid]))
+	}
+}
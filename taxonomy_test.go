@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/chanzuckerberg/ncbi-tool-search/accession"
+)
+
+func TestRangeTaxColumn(t *testing.T) {
+	run := &matchRun{taxa: accession.TaxIndex{"XP_1": 9606, "XP_2": 9606,
+		"XP_3": 10090, "XP_5": 9606}}
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{1, 2, " | taxid 9606"},
+		{1, 3, " | taxid -"}, // Differs
+		{4, 5, " | taxid -"}, // XP_4 unknown
+		{5, 5, " | taxid 9606"},
+	}
+	for _, tt := range tests {
+		if got := rangeTaxColumn(run, "XP_", tt.start, tt.end); got != tt.want {
+			t.Errorf("rangeTaxColumn(XP_%d-%d) = %q. Want %q", tt.start,
+				tt.end, got, tt.want)
+		}
+	}
+	if got := rangeTaxColumn(&matchRun{}, "XP_", 1, 2); got != "" {
+		t.Errorf("Got %q without taxids loaded. Want none", got)
+	}
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound matches every NotFoundError with errors.Is.
+var ErrNotFound = errors.New("not found")
+
+// An Error is an error with what was being done and where, from Handle. The
+// underlying error is kept for errors.Is and errors.As.
+type Error struct {
+	Msg  string // What was being done. E.g. "Error in downloading file."
+	Func string // Function that called Handle
+	File string // File and line of the call
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Msg + " " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// A DownloadError is a failed download of a remote file.
+type DownloadError struct {
+	Source string // Server or bucket. E.g. rsync://ftp.ncbi.nlm.nih.gov
+	File   string // Remote path. E.g. /genbank/gbbct1.seq.gz
+	Err    error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("download of %s from %s failed: %v", e.File, e.Source,
+		e.Err)
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// A ParseError is a line (or whole file if Line is 0) that couldn't be
+// parsed. File is empty if the text didn't come from a file, or the caller
+// that knows the file fills it in.
+type ParseError struct {
+	File string
+	Line int    // 1-based. 0 if unknown
+	Text string // What couldn't be parsed, if short
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	res := []string{}
+	if e.File != "" && e.Line > 0 {
+		res = append(res, e.File+":"+strconv.Itoa(e.Line))
+	} else if e.File != "" {
+		res = append(res, e.File)
+	}
+	if e.Text != "" {
+		res = append(res, fmt.Sprintf("can't parse %q", e.Text))
+	}
+	return strings.Join(append(res, e.Err.Error()), ": ")
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// A NotFoundError is a missing input. E.g. a local or remote file.
+type NotFoundError struct {
+	What string // Kind of thing. E.g. "remote file"
+	Name string
+	Err  error // Underlying error, if any. E.g. os.ErrNotExist
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s %s not found", e.What, e.Name)
+	}
+	return fmt.Sprintf("%s %s not found: %v", e.What, e.Name, e.Err)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrNotFound) true.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// An ExternalToolError is a failed run of an external command like rsync or
+// sift.
+type ExternalToolError struct {
+	Cmd      string // Command line
+	ExitCode int    // -1 if it didn't exit on its own (e.g. stopped)
+	Stderr   string // End of its stderr
+	Err      error
+}
+
+func (e *ExternalToolError) Error() string {
+	res := fmt.Sprintf("%s: %v", e.Cmd, e.Err)
+	if e.Stderr != "" {
+		res += ". stderr: " + e.Stderr
+	}
+	return res
+}
+
+func (e *ExternalToolError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,263 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Most stderr kept from each command for error messages. Earlier output is
+// dropped.
+const maxStderr = 64 * 1024
+
+// How long a stopped command gets to clean up (e.g. rsync temp files) before
+// it's killed.
+const stopGrace = 5 * time.Second
+
+// A Cmd is an external command as an argv list. Nothing goes through a
+// shell, so file names are passed as-is without quoting.
+type Cmd struct {
+	Args    []string      // Program and arguments
+	Timeout time.Duration // Stopped if it runs longer. 0 for no limit
+}
+
+// Command makes a Cmd without a timeout.
+func Command(args ...string) Cmd {
+	return Cmd{Args: args}
+}
+
+// String gives the command line for logs.
+func (c Cmd) String() string {
+	return strings.Join(c.Args, " ")
+}
+
+// Run runs a pipeline of commands, with each one's stdout going to the next
+// one's stdin, and the last one's stdout streamed to out (discarded if nil).
+// Each command runs in its own process group, so if ctx is cancelled or a
+// command runs past its timeout, it and everything it started get stopped.
+// Fails with an *ExternalToolError for the first command in the pipeline that
+// failed, with its exit code and the end of its stderr.
+//
+// Example: sort a file and count the unique lines.
+//
+//	err := util.Run(ctx, os.Stdout, util.Command("sort", path),
+//	    util.Command("uniq", "-c"))
+func Run(ctx context.Context, out io.Writer, cmds ...Cmd) error {
+	if len(cmds) == 0 {
+		return errors.New("no command to run")
+	}
+	if out == nil {
+		out = io.Discard
+	}
+	procs := make([]*process, len(cmds))
+	for i, c := range cmds {
+		if len(c.Args) == 0 {
+			return errors.New("empty command in pipeline")
+		}
+		p := &process{Cmd: c, stderr: &tailBuffer{max: maxStderr}}
+		p.cmd = exec.Command(c.Args[0], c.Args[1:]...)
+		p.cmd.Stderr = p.stderr
+		p.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		procs[i] = p
+	}
+
+	// Connect the pipeline
+	pipes := []*os.File{} // Parent's copies of the pipe ends
+	defer func() {
+		for _, f := range pipes {
+			f.Close()
+		}
+	}()
+	for i, p := range procs {
+		if i == len(procs)-1 {
+			p.cmd.Stdout = out
+			continue
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		pipes = append(pipes, r, w)
+		p.cmd.Stdout = w
+		procs[i+1].cmd.Stdin = r
+	}
+
+	// Start
+	started := 0
+	for _, p := range procs {
+		if err := p.cmd.Start(); err != nil {
+			for _, s := range procs[:started] {
+				stopGroup(s.cmd.Process, nil)
+				s.wait()
+			}
+			return &ExternalToolError{Cmd: p.String(), ExitCode: -1,
+				Err: err}
+		}
+		p.done = make(chan struct{})
+		go p.watch(ctx)
+		started++
+	}
+	// Only the children hold the pipe ends now, so each command sees EOF or
+	// a closed pipe when its neighbor exits.
+	for _, f := range pipes {
+		f.Close()
+	}
+	pipes = nil
+
+	// Wait for all of them. Report the first failure in pipeline order.
+	var res error
+	for _, p := range procs {
+		err := p.wait()
+		if res == nil && err != nil {
+			res = err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return res
+}
+
+// Lines runs a pipeline like Run and calls fn with each line of the output
+// as it comes. If fn returns an error, the pipeline is stopped and that error
+// is returned.
+func Lines(ctx context.Context, fn func(line string) error,
+	cmds ...Cmd) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r, w := io.Pipe()
+	runErr := make(chan error, 1)
+	go func() {
+		err := Run(ctx, w, cmds...)
+		w.CloseWithError(err)
+		runErr <- err
+	}()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var err error
+	for scanner.Scan() {
+		if err = fn(scanner.Text()); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+	if err != nil {
+		// Stop the pipeline and let it finish writing.
+		cancel()
+		r.CloseWithError(err)
+		<-runErr
+		return err
+	}
+	return <-runErr
+}
+
+// Output runs a pipeline like Run and gives all of its output. For commands
+// with short output, like listings.
+func Output(ctx context.Context, cmds ...Cmd) (string, error) {
+	var out strings.Builder
+	err := Run(ctx, &out, cmds...)
+	return out.String(), err
+}
+
+// A process is a running command of a pipeline.
+type process struct {
+	Cmd
+	cmd      *exec.Cmd
+	stderr   *tailBuffer
+	done     chan struct{} // Closed when it has exited
+	timedOut int32         // Set to 1 if stopped for its timeout
+}
+
+// watch stops the process if ctx is cancelled or it runs past its timeout.
+func (p *process) watch(ctx context.Context) {
+	var timeout <-chan time.Time
+	if p.Timeout > 0 {
+		timer := time.NewTimer(p.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		stopGroup(p.cmd.Process, p.done)
+	case <-timeout:
+		atomic.StoreInt32(&p.timedOut, 1)
+		stopGroup(p.cmd.Process, p.done)
+	case <-p.done:
+	}
+}
+
+// wait waits for the process to exit and gives an *ExternalToolError if it
+// failed. Timeouts match context.DeadlineExceeded with errors.Is.
+func (p *process) wait() error {
+	err := p.cmd.Wait()
+	close(p.done)
+	if err == nil {
+		return nil
+	}
+	res := &ExternalToolError{Cmd: p.String(), ExitCode: -1, Err: err,
+		Stderr: strings.TrimSpace(p.stderr.String())}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		res.ExitCode = exitErr.ExitCode() // -1 if killed by a signal
+	}
+	if atomic.LoadInt32(&p.timedOut) == 1 {
+		res.Err = fmt.Errorf("timed out after %s: %w", p.Timeout,
+			context.DeadlineExceeded)
+	}
+	return res
+}
+
+// Stops a command's process group with SIGTERM, then SIGKILL if it hasn't
+// exited (done closed) after stopGrace. Killed right away if done is nil.
+func stopGroup(proc *os.Process, done chan struct{}) {
+	if done == nil {
+		syscall.Kill(-proc.Pid, syscall.SIGKILL)
+		return
+	}
+	syscall.Kill(-proc.Pid, syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(stopGrace):
+		syscall.Kill(-proc.Pid, syscall.SIGKILL)
+	}
+}
+
+// A tailBuffer keeps the last max bytes written to it. Safe for concurrent
+// use.
+type tailBuffer struct {
+	mu        sync.Mutex
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return "..." + string(b.buf)
+	}
+	return string(b.buf)
+}
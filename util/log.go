@@ -0,0 +1,54 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// SetupLogging sends the diagnostic logs to w (usually stderr, so data output
+// on stdout stays separate). format is text or json. level is debug, info,
+// warn, or error. Quiet only keeps warnings and errors. Output from the log
+// package goes through the same handler at info level.
+func SetupLogging(w io.Writer, format string, level string, quiet bool) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	if quiet && lvl < slog.LevelWarn {
+		lvl = slog.LevelWarn
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	log.SetFlags(0) // The handler adds the time.
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+type logKey struct{}
+
+// WithLog gives a context whose logger (see Log) has extra fields for a
+// stage of work. E.g. WithLog(ctx, "worker", 3, "file", file).
+func WithLog(ctx context.Context, args ...interface{}) context.Context {
+	return context.WithValue(ctx, logKey{}, Log(ctx).With(args...))
+}
+
+// Log gets the logger for ctx, with the fields added by WithLog. The default
+// logger if there are none.
+func Log(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(logKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
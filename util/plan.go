@@ -0,0 +1,166 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+// Kinds of steps in a dry run plan.
+const (
+	PlanList      = "list"      // Remote folder listed
+	PlanDownload  = "download"  // Remote file downloaded
+	PlanCreate    = "create"    // New local file or folder written
+	PlanOverwrite = "overwrite" // Existing local file or folder replaced
+	PlanRun       = "run"       // External command run
+	PlanSkip      = "skip"      // Up to date already
+)
+
+// A Plan collects what a dry run would do instead of doing it. Code with
+// side effects checks DryRun and records the steps with Planned instead.
+// Safe for concurrent use.
+//
+// Example:
+//
+//	plan := &util.Plan{}
+//	ctx = util.WithPlan(ctx, plan)
+//	...
+//	if util.DryRun(ctx) {
+//	    util.PlannedOutput(ctx, path, size)
+//	    return nil
+//	}
+//	...
+//	plan.Write(os.Stdout)
+type Plan struct {
+	mu    sync.Mutex
+	Steps []PlanStep
+}
+
+// A PlanStep is one thing a dry run would do.
+type PlanStep struct {
+	Stage string // Stage or run it's part of
+	Kind  string // One of the Plan kinds. E.g. PlanDownload
+	Path  string // Local path, remote path, or command
+	Bytes int64  // Estimated size. -1 if unknown
+}
+
+type planKey struct{}
+
+// A planContext is the plan and stage name carried by a context.
+type planContext struct {
+	plan  *Plan
+	stage string
+}
+
+// WithPlan gives a context for a dry run that records into plan.
+func WithPlan(ctx context.Context, plan *Plan) context.Context {
+	return context.WithValue(ctx, planKey{}, planContext{plan: plan})
+}
+
+// WithPlanStage gives a context whose planned steps are part of a stage.
+// E.g. a pipeline stage. Does nothing if ctx isn't a dry run.
+func WithPlanStage(ctx context.Context, stage string) context.Context {
+	pc, ok := ctx.Value(planKey{}).(planContext)
+	if !ok {
+		return ctx
+	}
+	pc.stage = stage
+	return context.WithValue(ctx, planKey{}, pc)
+}
+
+// DryRun checks if ctx is a dry run, where nothing should be downloaded or
+// written.
+func DryRun(ctx context.Context) bool {
+	_, ok := ctx.Value(planKey{}).(planContext)
+	return ok
+}
+
+// Planned records a step of a dry run. Does nothing if ctx isn't a dry run.
+func Planned(ctx context.Context, kind string, path string, bytes int64) {
+	pc, ok := ctx.Value(planKey{}).(planContext)
+	if !ok {
+		return
+	}
+	pc.plan.mu.Lock()
+	defer pc.plan.mu.Unlock()
+	pc.plan.Steps = append(pc.plan.Steps, PlanStep{Stage: pc.stage,
+		Kind: kind, Path: path, Bytes: bytes})
+}
+
+// PlannedOutput records a local file or folder that a dry run would create,
+// or overwrite if it exists. bytes is the estimated size, -1 if unknown.
+func PlannedOutput(ctx context.Context, path string, bytes int64) {
+	kind := PlanCreate
+	if _, err := os.Stat(path); err == nil {
+		kind = PlanOverwrite
+	}
+	Planned(ctx, kind, path, bytes)
+}
+
+// Write prints the steps of the plan and the counts and estimated bytes of
+// each kind of step.
+func (p *Plan) Write(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	type total struct {
+		count, unknown int
+		bytes          int64
+	}
+	totals := make(map[string]*total)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "DRY RUN PLAN. Nothing was downloaded or written.")
+	fmt.Fprintln(tw, "Stage\tStep\tSize\tPath")
+	for _, s := range p.Steps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Stage, s.Kind,
+			formatBytes(s.Bytes), s.Path)
+		t := totals[s.Kind]
+		if t == nil {
+			t = &total{}
+			totals[s.Kind] = t
+		}
+		t.count++
+		if s.Bytes < 0 {
+			t.unknown++
+		} else {
+			t.bytes += s.Bytes
+		}
+	}
+	fmt.Fprintln(tw, "\nTOTALS:")
+	kinds := []string{}
+	for k := range totals {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		t := totals[k]
+		size := formatBytes(t.bytes)
+		if t.unknown == t.count {
+			size = formatBytes(-1)
+		}
+		line := fmt.Sprintf("%s:\t%d\t%s", k, t.count, size)
+		if t.unknown > 0 && t.unknown < t.count {
+			line += fmt.Sprintf("\t(%d of unknown size)", t.unknown)
+		}
+		fmt.Fprintln(tw, line)
+	}
+	return tw.Flush()
+}
+
+// Formats a size for the plan. E.g. 1.2 GB. "?" if unknown.
+func formatBytes(n int64) string {
+	switch {
+	case n < 0:
+		return "?"
+	case n >= 1e9:
+		return fmt.Sprintf("%.1f GB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1f KB", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,54 @@
+// Package util has the error handling, external command, and timing helpers
+// shared by the ncbi-tool-search packages.
+package util
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"runtime"
+	"strings"
+)
+
+// Combines string and error into new error. The error is wrapped, so
+// errors.Is and errors.As still see it.
+func NewErr(input string, err error) error {
+	err = fmt.Errorf("%s %w", input, err)
+	slog.Error(err.Error())
+	return err
+}
+
+// Handle logs errors and information at runtime. Used for easier error tracing
+// up the call stack. The error is wrapped in an *Error with the message and
+// the caller's location, which are also the fields of the log entry.
+func Handle(input string, err error) error {
+	if err == nil {
+		return err
+	}
+	if input[len(input)-1:] != "." { // Add a period.
+		input += "."
+	}
+	res := &Error{Msg: input, Err: err}
+	pc, fn, line, ok := runtime.Caller(1)
+	if !ok {
+		slog.Error(input, "err", err.Error())
+		return res
+	}
+	p := strings.Split(fn, "/")
+	res.Func = runtime.FuncForPC(pc).Name()
+	res.File, res.Line = p[len(p)-1], line
+	slog.Error(input, "func", res.Func, "file", res.File, "line", res.Line,
+		"err", err.Error())
+	return res
+}
+
+// UserHome gets the full path of the user's home directory.
+func UserHome() string {
+	usr, err := user.Current()
+	if err != nil {
+		slog.Error("Couldn't get user's home directory.", "err", err.Error())
+		os.Exit(1)
+	}
+	return usr.HomeDir
+}